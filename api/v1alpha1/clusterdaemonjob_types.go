@@ -0,0 +1,98 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterDaemonJobSpec defines the desired state of ClusterDaemonJob
+type ClusterDaemonJobSpec struct {
+
+	// The namespace the jobs are created in.
+	// +kubebuilder:validation:MinLength=1
+	TargetNamespace string `json:"targetNamespace"`
+
+	// Specifies the job that will be created when executing a ClusterDaemonJob.
+	// Required unless steps is set.
+	// +optional
+	JobTemplate JobTemplateSpec `json:"jobTemplate,omitempty"`
+
+	// Specifies jobs that run one after another on each node, instead of the jobTemplate.
+	// A step only runs on a node once the previous step completed on it.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Steps []StepSpec `json:"steps,omitempty"`
+
+	// Specifies a job that checks the node before the jobTemplate runs.
+	// If set, the jobTemplate only runs on the nodes where the check job fails.
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	CheckTemplate *JobTemplateSpec `json:"checkTemplate,omitempty"`
+
+	// If true, the check job runs again once the jobTemplate completed on a node,
+	// to verify the node has been remediated. Only used with checkTemplate.
+	// +optional
+	VerifyAfterFix bool `json:"verifyAfterFix,omitempty"`
+
+	// The name of a group of DaemonJobs and ClusterDaemonJobs whose jobs never
+	// run at the same time on a node.
+	// +optional
+	ExclusionGroup string `json:"exclusionGroup,omitempty"`
+
+	// The priority of the ClusterDaemonJob when the operator limits the number
+	// of active jobs: the highest priorities get the free slots first.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:JSONPath=".spec.targetNamespace",name="NAMESPACE",type="string"
+//+kubebuilder:printcolumn:JSONPath=".status.desiredNumberScheduled",name="DESIRED",type="integer"
+//+kubebuilder:printcolumn:JSONPath=".status.numberAvailable",name="AVAILABLE",type="integer"
+//+kubebuilder:printcolumn:JSONPath=".status.completedJobs",name="COMPLETED",type="integer"
+//+kubebuilder:printcolumn:JSONPath=".status.failedJobs",name="Failed",type="integer"
+
+// ClusterDaemonJob is the Schema for the clusterdaemonjobs API. It stays in
+// v1alpha1, without the features of the v1beta1 DaemonJob: its status has no
+// rerunToken, retries, memory bumps, onFailure phase, quarantine, marks,
+// cordon nor reboot, and the rerun annotations are ignored.
+type ClusterDaemonJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterDaemonJobSpec `json:"spec,omitempty"`
+	Status DaemonJobStatus      `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterDaemonJobList contains a list of ClusterDaemonJob
+type ClusterDaemonJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterDaemonJob `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterDaemonJob{}, &ClusterDaemonJobList{})
+}
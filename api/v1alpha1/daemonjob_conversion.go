@@ -0,0 +1,312 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+const (
+	// hubSpecAnnotation keeps the v1beta1 fields of a DaemonJob read as
+	// v1alpha1, so that they survive a round trip.
+	hubSpecAnnotation = "daemon.justk8s.com/v1beta1-spec"
+	// hubStatusAnnotation keeps the v1beta1 status fields of a DaemonJob read
+	// as v1alpha1. They record the nodes the controller tainted, labeled,
+	// cordoned or is rebooting, and must survive a v1alpha1 status update.
+	hubStatusAnnotation = "daemon.justk8s.com/v1beta1-status"
+)
+
+// hubSpec holds the fields of the v1beta1 spec that v1alpha1 has no place for.
+// +kubebuilder:object:generate=false
+type hubSpec struct {
+	NodeSelector     *metav1.LabelSelector       `json:"nodeSelector,omitempty"`
+	TeardownTemplate *v1beta1.JobTemplateSpec    `json:"teardownTemplate,omitempty"`
+	DeletionPolicy   v1beta1.DeletionPolicy      `json:"deletionPolicy,omitempty"`
+	NodeRetryPolicy  *v1beta1.NodeRetryPolicy    `json:"nodeRetryPolicy,omitempty"`
+	OOMRetry         *v1beta1.OOMRetry           `json:"oomRetry,omitempty"`
+	OnFailure        *v1beta1.OnFailureSpec      `json:"onFailure,omitempty"`
+	OnSuccess        *v1beta1.OnSuccessSpec      `json:"onSuccess,omitempty"`
+	Maintenance      *v1beta1.MaintenanceSpec    `json:"maintenance,omitempty"`
+	Reboot           *v1beta1.RebootSpec         `json:"reboot,omitempty"`
+	NodeConditions   *v1beta1.NodeConditionsSpec `json:"nodeConditions,omitempty"`
+}
+
+// hubStatus holds the fields of the v1beta1 status that v1alpha1 has no place
+// for.
+// +kubebuilder:object:generate=false
+type hubStatus struct {
+	Nodes      []hubNodeStatus `json:"nodes,omitempty"`
+	RerunToken string          `json:"rerunToken,omitempty"`
+}
+
+// hubNodeStatus holds the fields of the v1beta1 status of a node that
+// v1alpha1 has no place for.
+// +kubebuilder:object:generate=false
+type hubNodeStatus struct {
+	NodeName    string              `json:"nodeName"`
+	Retries     int32               `json:"retries,omitempty"`
+	MemoryBumps int32               `json:"memoryBumps,omitempty"`
+	OnFailure   v1beta1.NodePhase   `json:"onFailure,omitempty"`
+	Quarantined bool                `json:"quarantined,omitempty"`
+	Marked      bool                `json:"marked,omitempty"`
+	Cordoned    bool                `json:"cordoned,omitempty"`
+	Reboot      v1beta1.RebootPhase `json:"reboot,omitempty"`
+}
+
+// restoreAnnotation decodes into v the annotation keeping v1beta1 fields, if
+// any, and removes it.
+func restoreAnnotation(meta *metav1.ObjectMeta, key string, v interface{}) error {
+	raw, ok := meta.Annotations[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), v); err != nil {
+		return err
+	}
+	delete(meta.Annotations, key)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	return nil
+}
+
+// keepAnnotation encodes v in the annotation keeping v1beta1 fields.
+func keepAnnotation(meta *metav1.ObjectMeta, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	meta.Annotations[key] = string(raw)
+	return nil
+}
+
+// ConvertTo converts this DaemonJob to the Hub version (v1beta1).
+func (src *DaemonJob) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.DaemonJob)
+
+	// ObjectMeta
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	var restored hubSpec
+	if err := restoreAnnotation(&dst.ObjectMeta, hubSpecAnnotation, &restored); err != nil {
+		return err
+	}
+	var restoredStatus hubStatus
+	if err := restoreAnnotation(&dst.ObjectMeta, hubStatusAnnotation, &restoredStatus); err != nil {
+		return err
+	}
+	dst.Spec.NodeSelector = restored.NodeSelector
+	dst.Spec.TeardownTemplate = restored.TeardownTemplate
+	dst.Spec.DeletionPolicy = restored.DeletionPolicy
+	dst.Spec.NodeRetryPolicy = restored.NodeRetryPolicy
+	dst.Spec.OOMRetry = restored.OOMRetry
+	dst.Spec.OnFailure = restored.OnFailure
+	dst.Spec.OnSuccess = restored.OnSuccess
+	dst.Spec.Maintenance = restored.Maintenance
+	dst.Spec.Reboot = restored.Reboot
+	dst.Spec.NodeConditions = restored.NodeConditions
+
+	// Spec
+	dst.Spec.JobTemplate = v1beta1.JobTemplateSpec(*src.Spec.JobTemplate.DeepCopy())
+	dst.Spec.Steps = nil
+	for _, step := range src.Spec.Steps {
+		dst.Spec.Steps = append(dst.Spec.Steps, v1beta1.StepSpec{
+			Name:        step.Name,
+			JobTemplate: v1beta1.JobTemplateSpec(*step.JobTemplate.DeepCopy()),
+		})
+	}
+	dst.Spec.CheckTemplate = nil
+	if src.Spec.CheckTemplate != nil {
+		checkTemplate := v1beta1.JobTemplateSpec(*src.Spec.CheckTemplate.DeepCopy())
+		dst.Spec.CheckTemplate = &checkTemplate
+	}
+	dst.Spec.VerifyAfterFix = src.Spec.VerifyAfterFix
+	dst.Spec.DependsOn = nil
+	for _, dependency := range src.Spec.DependsOn {
+		dst.Spec.DependsOn = append(dst.Spec.DependsOn, v1beta1.DaemonJobReference(dependency))
+	}
+	dst.Spec.ExclusionGroup = src.Spec.ExclusionGroup
+	dst.Spec.Priority = src.Spec.Priority
+	dst.Spec.Report = nil
+	if src.Spec.Report != nil {
+		report := v1beta1.ReportSpec(*src.Spec.Report)
+		dst.Spec.Report = &report
+	}
+	dst.Spec.ExpectConsistentOutput = nil
+	if src.Spec.ExpectConsistentOutput != nil {
+		consistency := v1beta1.ConsistencySpec(*src.Spec.ExpectConsistentOutput)
+		dst.Spec.ExpectConsistentOutput = &consistency
+	}
+
+	// Status
+	status := src.Status.DeepCopy()
+	dst.Status.DesiredNumberScheduled = status.DesiredNumberScheduled
+	dst.Status.NumberAvailable = status.NumberAvailable
+	dst.Status.CompletedJobs = status.CompletedJobs
+	dst.Status.FailedJobs = status.FailedJobs
+	restoredNodes := make(map[string]hubNodeStatus, len(restoredStatus.Nodes))
+	for _, node := range restoredStatus.Nodes {
+		restoredNodes[node.NodeName] = node
+	}
+	dst.Status.Nodes = nil
+	for _, node := range status.Nodes {
+		restoredNode := restoredNodes[node.NodeName]
+		dst.Status.Nodes = append(dst.Status.Nodes, v1beta1.NodeStatus{
+			NodeName:    node.NodeName,
+			Phase:       v1beta1.NodePhase(node.Phase),
+			Step:        node.Step,
+			Reason:      node.Reason,
+			Retries:     restoredNode.Retries,
+			MemoryBumps: restoredNode.MemoryBumps,
+			Compliance:  v1beta1.NodeCompliance(node.Compliance),
+			OnFailure:   restoredNode.OnFailure,
+			Quarantined: restoredNode.Quarantined,
+			Marked:      restoredNode.Marked,
+			Cordoned:    restoredNode.Cordoned,
+			Reboot:      restoredNode.Reboot,
+		})
+	}
+	dst.Status.Drift = nil
+	if status.Drift != nil {
+		dst.Status.Drift = &v1beta1.DriftStatus{
+			ExpectedValue:   status.Drift.ExpectedValue,
+			ConsistentNodes: status.Drift.ConsistentNodes,
+		}
+		for _, node := range status.Drift.DriftedNodes {
+			dst.Status.Drift.DriftedNodes = append(dst.Status.Drift.DriftedNodes, v1beta1.DriftedNode(node))
+		}
+	}
+	dst.Status.RerunToken = restoredStatus.RerunToken
+	dst.Status.Conditions = status.Conditions
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *DaemonJob) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.DaemonJob)
+
+	// ObjectMeta
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	restored := hubSpec{
+		NodeSelector:     src.Spec.NodeSelector,
+		TeardownTemplate: src.Spec.TeardownTemplate,
+		DeletionPolicy:   src.Spec.DeletionPolicy,
+		NodeRetryPolicy:  src.Spec.NodeRetryPolicy,
+		OOMRetry:         src.Spec.OOMRetry,
+		OnFailure:        src.Spec.OnFailure,
+		OnSuccess:        src.Spec.OnSuccess,
+		Maintenance:      src.Spec.Maintenance,
+		Reboot:           src.Spec.Reboot,
+		NodeConditions:   src.Spec.NodeConditions,
+	}
+	if restored != (hubSpec{}) {
+		if err := keepAnnotation(&dst.ObjectMeta, hubSpecAnnotation, restored); err != nil {
+			return err
+		}
+	}
+	restoredStatus := hubStatus{RerunToken: src.Status.RerunToken}
+	for _, node := range src.Status.Nodes {
+		restoredNode := hubNodeStatus{
+			NodeName:    node.NodeName,
+			Retries:     node.Retries,
+			MemoryBumps: node.MemoryBumps,
+			OnFailure:   node.OnFailure,
+			Quarantined: node.Quarantined,
+			Marked:      node.Marked,
+			Cordoned:    node.Cordoned,
+			Reboot:      node.Reboot,
+		}
+		if restoredNode != (hubNodeStatus{NodeName: node.NodeName}) {
+			restoredStatus.Nodes = append(restoredStatus.Nodes, restoredNode)
+		}
+	}
+	if restoredStatus.RerunToken != "" || len(restoredStatus.Nodes) > 0 {
+		if err := keepAnnotation(&dst.ObjectMeta, hubStatusAnnotation, restoredStatus); err != nil {
+			return err
+		}
+	}
+
+	// Spec
+	dst.Spec.JobTemplate = JobTemplateSpec(*src.Spec.JobTemplate.DeepCopy())
+	dst.Spec.Steps = nil
+	for _, step := range src.Spec.Steps {
+		dst.Spec.Steps = append(dst.Spec.Steps, StepSpec{
+			Name:        step.Name,
+			JobTemplate: JobTemplateSpec(*step.JobTemplate.DeepCopy()),
+		})
+	}
+	dst.Spec.CheckTemplate = nil
+	if src.Spec.CheckTemplate != nil {
+		checkTemplate := JobTemplateSpec(*src.Spec.CheckTemplate.DeepCopy())
+		dst.Spec.CheckTemplate = &checkTemplate
+	}
+	dst.Spec.VerifyAfterFix = src.Spec.VerifyAfterFix
+	dst.Spec.DependsOn = nil
+	for _, dependency := range src.Spec.DependsOn {
+		dst.Spec.DependsOn = append(dst.Spec.DependsOn, DaemonJobReference(dependency))
+	}
+	dst.Spec.ExclusionGroup = src.Spec.ExclusionGroup
+	dst.Spec.Priority = src.Spec.Priority
+	dst.Spec.Report = nil
+	if src.Spec.Report != nil {
+		report := ReportSpec(*src.Spec.Report)
+		dst.Spec.Report = &report
+	}
+	dst.Spec.ExpectConsistentOutput = nil
+	if src.Spec.ExpectConsistentOutput != nil {
+		consistency := ConsistencySpec(*src.Spec.ExpectConsistentOutput)
+		dst.Spec.ExpectConsistentOutput = &consistency
+	}
+
+	// Status
+	status := src.Status.DeepCopy()
+	dst.Status.DesiredNumberScheduled = status.DesiredNumberScheduled
+	dst.Status.NumberAvailable = status.NumberAvailable
+	dst.Status.CompletedJobs = status.CompletedJobs
+	dst.Status.FailedJobs = status.FailedJobs
+	dst.Status.Nodes = nil
+	for _, node := range status.Nodes {
+		dst.Status.Nodes = append(dst.Status.Nodes, NodeStatus{
+			NodeName:   node.NodeName,
+			Phase:      NodePhase(node.Phase),
+			Step:       node.Step,
+			Reason:     node.Reason,
+			Compliance: NodeCompliance(node.Compliance),
+		})
+	}
+	dst.Status.Drift = nil
+	if status.Drift != nil {
+		dst.Status.Drift = &DriftStatus{
+			ExpectedValue:   status.Drift.ExpectedValue,
+			ConsistentNodes: status.Drift.ConsistentNodes,
+		}
+		for _, node := range status.Drift.DriftedNodes {
+			dst.Status.Drift.DriftedNodes = append(dst.Status.Drift.DriftedNodes, DriftedNode(node))
+		}
+	}
+	dst.Status.Conditions = status.Conditions
+
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("DaemonJob conversion", func() {
+
+	var jobTemplate JobTemplateSpec
+
+	BeforeEach(func() {
+		jobTemplate = JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers:    []corev1.Container{{Name: "hello", Image: "busybox"}},
+						RestartPolicy: corev1.RestartPolicyOnFailure,
+					},
+				},
+			},
+		}
+	})
+
+	It("should convert a v1alpha1 DaemonJob to v1beta1 and back", func() {
+		available := int32(1)
+		daemonJob := &DaemonJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "daemonjob-sample", Namespace: "default"},
+			Spec: DaemonJobSpec{
+				Steps:          []StepSpec{{Name: "apply", JobTemplate: jobTemplate}},
+				CheckTemplate:  jobTemplate.DeepCopy(),
+				VerifyAfterFix: true,
+				DependsOn:      []DaemonJobReference{{Name: "install-driver"}},
+				ExclusionGroup: "containerd",
+				Priority:       100,
+				Report:         &ReportSpec{ContainerName: "hello"},
+			},
+			Status: DaemonJobStatus{
+				DesiredNumberScheduled: 1,
+				NumberAvailable:        &available,
+				Nodes: []NodeStatus{
+					{NodeName: "worker-1", Phase: NodeSucceeded, Step: "apply", Compliance: NodeRemediated},
+				},
+			},
+		}
+
+		hub := &v1beta1.DaemonJob{}
+		Expect(daemonJob.ConvertTo(hub)).To(Succeed())
+		Expect(hub.Spec.Steps[0].Name).To(Equal("apply"))
+		Expect(hub.Spec.NodeSelector).To(BeNil())
+		Expect(hub.Status.Nodes[0].Compliance).To(Equal(v1beta1.NodeRemediated))
+
+		converted := &DaemonJob{}
+		Expect(converted.ConvertFrom(hub)).To(Succeed())
+		Expect(converted).To(Equal(daemonJob))
+	})
+
+	It("should keep the v1beta1 fields through v1alpha1", func() {
+		factor := resource.MustParse("3")
+		maxQuarantinedNodes := intstr.FromString("10%")
+		initialDelaySeconds := int32(10)
+		hub := &v1beta1.DaemonJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "daemonjob-sample", Namespace: "default"},
+			Spec: v1beta1.DaemonJobSpec{
+				JobTemplate: v1beta1.JobTemplateSpec(jobTemplate),
+				NodeSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"kubernetes.io/os": "linux"},
+				},
+				TeardownTemplate: (*v1beta1.JobTemplateSpec)(jobTemplate.DeepCopy()),
+				DeletionPolicy:   v1beta1.DeletionPolicyOrphan,
+				NodeRetryPolicy:  &v1beta1.NodeRetryPolicy{MaxRetries: 3, InitialDelaySeconds: &initialDelaySeconds, Multiplier: 2},
+				OOMRetry:         &v1beta1.OOMRetry{Factor: &factor, MaxMemory: resource.MustParse("4Gi")},
+				OnFailure: &v1beta1.OnFailureSpec{
+					JobTemplate: (*v1beta1.JobTemplateSpec)(jobTemplate.DeepCopy()),
+					NodeAction: &v1beta1.NodeAction{
+						Taint:               &corev1.Taint{Key: "quarantine", Effect: corev1.TaintEffectNoSchedule},
+						MaxQuarantinedNodes: &maxQuarantinedNodes,
+					},
+				},
+				OnSuccess: &v1beta1.OnSuccessSpec{
+					NodeLabels:   map[string]string{"gpu-driver.example.com/installed": "v535"},
+					RemoveTaints: []v1beta1.TaintSelector{{Key: "node.example.com/bootstrapping"}},
+				},
+				Maintenance: &v1beta1.MaintenanceSpec{
+					Drain:              &v1beta1.DrainSpec{DeleteEmptyDirData: true},
+					MaxConcurrentNodes: &maxQuarantinedNodes,
+				},
+				NodeConditions: &v1beta1.NodeConditionsSpec{
+					NotReady:           v1beta1.NodeConditionWait,
+					ScaleDownCandidate: v1beta1.NodeConditionSkip,
+				},
+				Reboot: &v1beta1.RebootSpec{
+					Message: "reboot-required",
+					JobTemplate: v1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: corev1.PodTemplateSpec{
+								Spec: corev1.PodSpec{
+									HostPID:       true,
+									RestartPolicy: corev1.RestartPolicyNever,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		daemonJob := &DaemonJob{}
+		Expect(daemonJob.ConvertFrom(hub)).To(Succeed())
+		Expect(daemonJob.Annotations).To(HaveKey(hubSpecAnnotation))
+
+		converted := &v1beta1.DaemonJob{}
+		Expect(daemonJob.ConvertTo(converted)).To(Succeed())
+		Expect(converted).To(Equal(hub))
+	})
+
+	It("should keep the v1beta1 status through v1alpha1", func() {
+		numberAvailable, completedJobs, failedJobs := int32(1), int32(1), int32(1)
+		hub := &v1beta1.DaemonJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "daemonjob-sample", Namespace: "default"},
+			Spec:       v1beta1.DaemonJobSpec{JobTemplate: v1beta1.JobTemplateSpec(jobTemplate)},
+			Status: v1beta1.DaemonJobStatus{
+				DesiredNumberScheduled: 2,
+				NumberAvailable:        &numberAvailable,
+				CompletedJobs:          &completedJobs,
+				FailedJobs:             &failedJobs,
+				Nodes: []v1beta1.NodeStatus{
+					{
+						NodeName:    "worker-1",
+						Phase:       v1beta1.NodeFailed,
+						Step:        "apply",
+						Reason:      "OOMKilled",
+						Retries:     2,
+						MemoryBumps: 1,
+						Compliance:  v1beta1.NodeNonCompliant,
+						OnFailure:   v1beta1.NodeSucceeded,
+						Quarantined: true,
+						Marked:      true,
+						Cordoned:    true,
+						Reboot:      v1beta1.RebootRequired,
+					},
+					{
+						NodeName: "worker-2",
+						Phase:    v1beta1.NodeSucceeded,
+					},
+				},
+				Drift: &v1beta1.DriftStatus{
+					ExpectedValue:   "5.15",
+					ConsistentNodes: 1,
+					DriftedNodes:    []v1beta1.DriftedNode{{NodeName: "worker-1", Value: "5.10"}},
+				},
+				RerunToken: "rerun-1",
+				Conditions: []metav1.Condition{{
+					Type:               v1beta1.DaemonJobDegraded,
+					Status:             metav1.ConditionTrue,
+					Reason:             "OutputMismatch",
+					LastTransitionTime: metav1.Now().Rfc3339Copy(),
+				}},
+			},
+		}
+
+		daemonJob := &DaemonJob{}
+		Expect(daemonJob.ConvertFrom(hub)).To(Succeed())
+		Expect(daemonJob.Annotations).To(HaveKey(hubStatusAnnotation))
+
+		converted := &v1beta1.DaemonJob{}
+		Expect(daemonJob.ConvertTo(converted)).To(Succeed())
+		Expect(converted).To(Equal(hub))
+	})
+})
@@ -42,9 +42,98 @@ type DaemonJobSpec struct {
 	// TODO: Add ignoreSelector mutually exclusive with selector // e.g MatchLabels
 
 	// Specifies the job that will be created when executing a DaemonJob.
+	// Required unless steps is set.
+	// +optional
+	JobTemplate JobTemplateSpec `json:"jobTemplate,omitempty"`
+
+	// Specifies jobs that run one after another on each node, instead of the jobTemplate.
+	// A step only runs on a node once the previous step completed on it.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Steps []StepSpec `json:"steps,omitempty"`
+
+	// Specifies a job that checks the node before the jobTemplate runs.
+	// If set, the jobTemplate only runs on the nodes where the check job fails.
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	CheckTemplate *JobTemplateSpec `json:"checkTemplate,omitempty"`
+
+	// If true, the check job runs again once the jobTemplate completed on a node,
+	// to verify the node has been remediated. Only used with checkTemplate.
+	// +optional
+	VerifyAfterFix bool `json:"verifyAfterFix,omitempty"`
+
+	// Specifies DaemonJobs, in the same namespace, that must have succeeded on a
+	// node before the jobs of this DaemonJob are created on that node.
+	// +optional
+	DependsOn []DaemonJobReference `json:"dependsOn,omitempty"`
+
+	// The name of a group of DaemonJobs, across all namespaces, whose jobs never
+	// run at the same time on a node. A job is not started on a node while
+	// another DaemonJob of the group has an active job there.
+	// +optional
+	ExclusionGroup string `json:"exclusionGroup,omitempty"`
+
+	// The priority of the DaemonJob when the operator limits the number of active
+	// jobs: the DaemonJobs with a higher priority get the free slots first.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Specifies how the output of the jobs is collected into NodeReports.
+	// If not set, no NodeReports are written.
+	// +optional
+	Report *ReportSpec `json:"report,omitempty"`
+
+	// If set, the output of the jobs is expected to be the same on every node.
+	// The nodes whose output differs from the majority are reported as drifted.
+	// +optional
+	ExpectConsistentOutput *ConsistencySpec `json:"expectConsistentOutput,omitempty"`
+}
+
+// StepSpec defines a named job run on each node as part of spec.steps
+type StepSpec struct {
+
+	// The name of the step, unique within the DaemonJob. It suffixes the name of
+	// the jobs of the step. "check" and "verify" are reserved for the checkTemplate.
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Specifies the job that will be created for the step.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
 	JobTemplate JobTemplateSpec `json:"jobTemplate"`
 }
 
+// DaemonJobReference references a DaemonJob in the same namespace
+type DaemonJobReference struct {
+
+	// The name of the DaemonJob.
+	Name string `json:"name"`
+}
+
+// ReportSpec defines how the output of a job is collected into a NodeReport
+type ReportSpec struct {
+
+	// The name of the container whose termination message holds the JSON output
+	// of the job. Defaults to the first container of the job template.
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+}
+
+// ConsistencySpec defines which part of the job output is compared across nodes
+type ConsistencySpec struct {
+
+	// A JSONPath expression selecting the value of the output that is compared
+	// across nodes, e.g. `{.sysctl.swappiness}`. Defaults to the whole output.
+	// +optional
+	JSONPath string `json:"jsonPath,omitempty"`
+}
+
 // DaemonJobStatus defines the observed state of DaemonJob
 type DaemonJobStatus struct {
 
@@ -65,8 +154,109 @@ type DaemonJobStatus struct {
 	// The number of jobs that are failed
 	// +optional
 	FailedJobs *int32 `json:"failedJobs,omitempty"`
+
+	// The state of the DaemonJob on every node.
+	// +optional
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+
+	// The drift of the job outputs across nodes, if spec.expectConsistentOutput is set.
+	// +optional
+	Drift *DriftStatus `json:"drift,omitempty"`
+
+	// Represents the latest available observations of the DaemonJob's state.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// NodePhase is the phase of a DaemonJob on a node
+type NodePhase string
+
+const (
+	// NodePending means no job has been created on the node yet.
+	NodePending NodePhase = "Pending"
+	// NodeRunning means the jobs of the node are running.
+	NodeRunning NodePhase = "Running"
+	// NodeSucceeded means the jobs of the node completed.
+	NodeSucceeded NodePhase = "Succeeded"
+	// NodeFailed means a job of the node failed.
+	NodeFailed NodePhase = "Failed"
+)
+
+// NodeCompliance is the outcome of the check job on a node
+type NodeCompliance string
+
+const (
+	// NodeCompliant means the check job succeeded, the jobTemplate did not run.
+	NodeCompliant NodeCompliance = "Compliant"
+	// NodeRemediated means the check job failed and the jobTemplate completed.
+	NodeRemediated NodeCompliance = "Remediated"
+	// NodeNonCompliant means the check job failed and the node could not be remediated.
+	NodeNonCompliant NodeCompliance = "NonCompliant"
+)
+
+// NodeStatus defines the observed state of a DaemonJob on a node
+type NodeStatus struct {
+
+	// The name of the node.
+	NodeName string `json:"nodeName"`
+
+	// The phase of the DaemonJob on the node.
+	Phase NodePhase `json:"phase"`
+
+	// The step the node is on, if spec.steps is set.
+	// +optional
+	Step string `json:"step,omitempty"`
+
+	// Why no job is started on the node, e.g. a DaemonJob of spec.dependsOn
+	// has not succeeded on the node yet, or another DaemonJob of the
+	// exclusion group is running there.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// The outcome of the check job on the node, if spec.checkTemplate is set.
+	// +optional
+	Compliance NodeCompliance `json:"compliance,omitempty"`
 }
 
+// DriftStatus defines the observed drift of the job outputs across nodes
+type DriftStatus struct {
+
+	// The value reported by the majority of the nodes.
+	// Empty if there is no majority.
+	// +optional
+	ExpectedValue string `json:"expectedValue,omitempty"`
+
+	// The number of nodes reporting the expected value.
+	ConsistentNodes int32 `json:"consistentNodes"`
+
+	// The nodes whose value differs from the expected value.
+	// +optional
+	DriftedNodes []DriftedNode `json:"driftedNodes,omitempty"`
+}
+
+// DriftedNode is a node whose job output differs from the majority
+type DriftedNode struct {
+
+	// The name of the node.
+	NodeName string `json:"nodeName"`
+
+	// The value reported by the node.
+	Value string `json:"value"`
+}
+
+const (
+	// DaemonJobDegraded means that some nodes are not in the state expected by the DaemonJob.
+	DaemonJobDegraded = "Degraded"
+
+	// DaemonJobJobConflict means that Jobs with the names of the DaemonJob Jobs
+	// exist, but are not owned by the DaemonJob.
+	DaemonJobJobConflict = "JobConflict"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:JSONPath=".status.desiredNumberScheduled",name="DESIRED",type="integer"
@@ -0,0 +1,88 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NodeReportSpec defines the output collected from a DaemonJob on a single node
+type NodeReportSpec struct {
+
+	// The name of the DaemonJob that produced this report.
+	DaemonJobName string `json:"daemonJobName"`
+
+	// The name of the node the output was collected from.
+	NodeName string `json:"nodeName"`
+
+	// The UID of the node the output was collected from.
+	// +optional
+	NodeUID types.UID `json:"nodeUID,omitempty"`
+
+	// The name of the Job the output was collected from.
+	JobName string `json:"jobName"`
+
+	// The hash of the jobTemplate the Job was created from.
+	// +optional
+	TemplateHash string `json:"templateHash,omitempty"`
+
+	// The parsed JSON output of the Job, read from the termination message
+	// of its container.
+	// +optional
+	Output *apiextensionsv1.JSON `json:"output,omitempty"`
+
+	// The reason the output of the Job could not be parsed, if any.
+	// +optional
+	OutputError string `json:"outputError,omitempty"`
+
+	// The time the Job was started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// The time the Job was completed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:JSONPath=".spec.daemonJobName",name="DAEMONJOB",type="string"
+//+kubebuilder:printcolumn:JSONPath=".spec.nodeName",name="NODE",type="string"
+//+kubebuilder:printcolumn:JSONPath=".spec.templateHash",name="TEMPLATE",type="string"
+//+kubebuilder:printcolumn:JSONPath=".spec.completionTime",name="COMPLETED",type="date"
+
+// NodeReport is the Schema for the nodereports API
+type NodeReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NodeReportSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NodeReportList contains a list of NodeReport
+type NodeReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeReport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeReport{}, &NodeReportList{})
+}
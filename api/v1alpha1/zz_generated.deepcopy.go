@@ -21,9 +21,113 @@ limitations under the License.
 package v1alpha1
 
 import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDaemonJob) DeepCopyInto(out *ClusterDaemonJob) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDaemonJob.
+func (in *ClusterDaemonJob) DeepCopy() *ClusterDaemonJob {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDaemonJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterDaemonJob) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDaemonJobList) DeepCopyInto(out *ClusterDaemonJobList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterDaemonJob, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDaemonJobList.
+func (in *ClusterDaemonJobList) DeepCopy() *ClusterDaemonJobList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDaemonJobList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterDaemonJobList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDaemonJobSpec) DeepCopyInto(out *ClusterDaemonJobSpec) {
+	*out = *in
+	in.JobTemplate.DeepCopyInto(&out.JobTemplate)
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]StepSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CheckTemplate != nil {
+		in, out := &in.CheckTemplate, &out.CheckTemplate
+		*out = new(JobTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDaemonJobSpec.
+func (in *ClusterDaemonJobSpec) DeepCopy() *ClusterDaemonJobSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDaemonJobSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsistencySpec) DeepCopyInto(out *ConsistencySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsistencySpec.
+func (in *ConsistencySpec) DeepCopy() *ConsistencySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsistencySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DaemonJob) DeepCopyInto(out *DaemonJob) {
 	*out = *in
@@ -83,10 +187,52 @@ func (in *DaemonJobList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DaemonJobReference) DeepCopyInto(out *DaemonJobReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJobReference.
+func (in *DaemonJobReference) DeepCopy() *DaemonJobReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DaemonJobReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DaemonJobSpec) DeepCopyInto(out *DaemonJobSpec) {
 	*out = *in
 	in.JobTemplate.DeepCopyInto(&out.JobTemplate)
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]StepSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CheckTemplate != nil {
+		in, out := &in.CheckTemplate, &out.CheckTemplate
+		*out = new(JobTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]DaemonJobReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Report != nil {
+		in, out := &in.Report, &out.Report
+		*out = new(ReportSpec)
+		**out = **in
+	}
+	if in.ExpectConsistentOutput != nil {
+		in, out := &in.ExpectConsistentOutput, &out.ExpectConsistentOutput
+		*out = new(ConsistencySpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJobSpec.
@@ -117,6 +263,23 @@ func (in *DaemonJobStatus) DeepCopyInto(out *DaemonJobStatus) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = new(DriftStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJobStatus.
@@ -129,6 +292,41 @@ func (in *DaemonJobStatus) DeepCopy() *DaemonJobStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftStatus) DeepCopyInto(out *DriftStatus) {
+	*out = *in
+	if in.DriftedNodes != nil {
+		in, out := &in.DriftedNodes, &out.DriftedNodes
+		*out = make([]DriftedNode, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftStatus.
+func (in *DriftStatus) DeepCopy() *DriftStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftedNode) DeepCopyInto(out *DriftedNode) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftedNode.
+func (in *DriftedNode) DeepCopy() *DriftedNode {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftedNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobTemplateSpec) DeepCopyInto(out *JobTemplateSpec) {
 	*out = *in
@@ -145,3 +343,135 @@ func (in *JobTemplateSpec) DeepCopy() *JobTemplateSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeReport) DeepCopyInto(out *NodeReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeReport.
+func (in *NodeReport) DeepCopy() *NodeReport {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeReportList) DeepCopyInto(out *NodeReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NodeReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeReportList.
+func (in *NodeReportList) DeepCopy() *NodeReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeReportSpec) DeepCopyInto(out *NodeReportSpec) {
+	*out = *in
+	if in.Output != nil {
+		in, out := &in.Output, &out.Output
+		*out = new(apiextensionsv1.JSON)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeReportSpec.
+func (in *NodeReportSpec) DeepCopy() *NodeReportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeReportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeStatus) DeepCopyInto(out *NodeStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeStatus.
+func (in *NodeStatus) DeepCopy() *NodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReportSpec) DeepCopyInto(out *ReportSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReportSpec.
+func (in *ReportSpec) DeepCopy() *ReportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StepSpec) DeepCopyInto(out *StepSpec) {
+	*out = *in
+	in.JobTemplate.DeepCopyInto(&out.JobTemplate)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StepSpec.
+func (in *StepSpec) DeepCopy() *StepSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StepSpec)
+	in.DeepCopyInto(out)
+	return out
+}
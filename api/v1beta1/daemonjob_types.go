@@ -0,0 +1,616 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// JobTemplateSpec defines the Template of DaemonJobSpec
+type JobTemplateSpec struct {
+	// Standard object's metadata of the jobs created from this template.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Specification of the desired behavior of the job.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#spec-and-status
+	// +optional
+	Spec batchv1.JobSpec `json:"spec,omitempty"`
+}
+
+// DaemonJobSpec defines the desired state of DaemonJob
+type DaemonJobSpec struct {
+
+	// Selects the nodes the jobs run on, by their labels.
+	// Defaults to every node.
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// What happens on the selected nodes that are NotReady, unschedulable or
+	// about to be removed by the cluster autoscaler. Defaults to running the
+	// jobs on every node.
+	// +optional
+	NodeConditions *NodeConditionsSpec `json:"nodeConditions,omitempty"`
+
+	// Specifies the job that will be created when executing a DaemonJob.
+	// Required unless steps is set.
+	// +optional
+	JobTemplate JobTemplateSpec `json:"jobTemplate,omitempty"`
+
+	// Specifies jobs that run one after another on each node, instead of the jobTemplate.
+	// A step only runs on a node once the previous step completed on it.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Steps []StepSpec `json:"steps,omitempty"`
+
+	// Specifies a job that checks the node before the jobTemplate runs.
+	// If set, the jobTemplate only runs on the nodes where the check job fails.
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	CheckTemplate *JobTemplateSpec `json:"checkTemplate,omitempty"`
+
+	// If true, the check job runs again once the jobTemplate completed on a node,
+	// to verify the node has been remediated. Only used with checkTemplate.
+	// +optional
+	VerifyAfterFix bool `json:"verifyAfterFix,omitempty"`
+
+	// Specifies DaemonJobs, in the same namespace, that must have succeeded on a
+	// node before the jobs of this DaemonJob are created on that node.
+	// +optional
+	DependsOn []DaemonJobReference `json:"dependsOn,omitempty"`
+
+	// The name of a group of DaemonJobs, across all namespaces, whose jobs never
+	// run at the same time on a node. A job is not started on a node while
+	// another DaemonJob of the group has an active job there.
+	// +optional
+	ExclusionGroup string `json:"exclusionGroup,omitempty"`
+
+	// The priority of the DaemonJob when the operator limits the number of active
+	// jobs: the DaemonJobs with a higher priority get the free slots first.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Specifies how the output of the jobs is collected into NodeReports.
+	// If not set, no NodeReports are written.
+	// +optional
+	Report *ReportSpec `json:"report,omitempty"`
+
+	// If set, the output of the jobs is expected to be the same on every node.
+	// The nodes whose output differs from the majority are reported as drifted.
+	// +optional
+	ExpectConsistentOutput *ConsistencySpec `json:"expectConsistentOutput,omitempty"`
+
+	// Specifies a job that runs, when the DaemonJob is deleted, on every node
+	// where the DaemonJob succeeded, e.g. to revert the node configuration.
+	// The DaemonJob goes away once these jobs finished.
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	TeardownTemplate *JobTemplateSpec `json:"teardownTemplate,omitempty"`
+
+	// What happens to the jobs when the DaemonJob is deleted: Delete removes
+	// them, Orphan leaves them in place without owner. Defaults to Delete.
+	// +optional
+	// +kubebuilder:default=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// If set, the job of a node that failed, once its backoffLimit is exhausted,
+	// is created again after a delay growing with each retry.
+	// +optional
+	NodeRetryPolicy *NodeRetryPolicy `json:"nodeRetryPolicy,omitempty"`
+
+	// If set, the job of a node that failed because a container was
+	// OOMKilled is created again with more memory on that node.
+	// +optional
+	OOMRetry *OOMRetry `json:"oomRetry,omitempty"`
+
+	// What happens on a node whose job failed.
+	// +optional
+	OnFailure *OnFailureSpec `json:"onFailure,omitempty"`
+
+	// What happens on a node whose job succeeded. The operator must run with
+	// node actions enabled.
+	// +optional
+	OnSuccess *OnSuccessSpec `json:"onSuccess,omitempty"`
+
+	// Cordons, and drains if requested, the nodes before their jobs run, and
+	// uncordons them once the jobs succeeded. The operator must run with node
+	// actions enabled.
+	// +optional
+	Maintenance *MaintenanceSpec `json:"maintenance,omitempty"`
+
+	// Reboots the nodes whose job requested it, a few at a time: the node is
+	// cordoned and drained, rebooted by the reboot job, then uncordoned once
+	// it is Ready with a new boot ID. The operator must run with node actions
+	// enabled.
+	// +optional
+	Reboot *RebootSpec `json:"reboot,omitempty"`
+}
+
+// NodeRetryPolicy defines how the failed job of a node is retried
+type NodeRetryPolicy struct {
+
+	// The maximum number of times the failed job of a node is created again.
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries int32 `json:"maxRetries"`
+
+	// The delay before the first retry, in seconds. Defaults to 10.
+	// +optional
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// The factor the delay is multiplied by after each retry. Defaults to 2.
+	// +optional
+	// +kubebuilder:default=2
+	// +kubebuilder:validation:Minimum=1
+	Multiplier int32 `json:"multiplier,omitempty"`
+}
+
+// OOMRetry defines how the memory of the jobs of a node grows after an OOM kill
+type OOMRetry struct {
+
+	// The factor the memory requests and limits of the containers are
+	// multiplied by after each OOM kill on the node, e.g. 1.5. Defaults to 2.
+	// +optional
+	Factor *resource.Quantity `json:"factor,omitempty"`
+
+	// The memory the requests and limits of a container never grow beyond.
+	MaxMemory resource.Quantity `json:"maxMemory"`
+}
+
+// OnFailureSpec defines what happens on a node whose job failed
+type OnFailureSpec struct {
+
+	// The job run on a node once its job, or one of its steps, failed, e.g.
+	// to collect diagnostics or to roll back a partial change.
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	JobTemplate *JobTemplateSpec `json:"jobTemplate,omitempty"`
+
+	// Quarantines a node whose job failed with a taint or labels, until a
+	// later job succeeds there. The operator must run with node actions
+	// enabled.
+	// +optional
+	NodeAction *NodeAction `json:"nodeAction,omitempty"`
+}
+
+// MaintenanceSpec defines how the nodes are taken out of service around their jobs
+type MaintenanceSpec struct {
+
+	// Cordons the node before its jobs run, and uncordons it once they succeeded.
+	// +optional
+	Cordon bool `json:"cordon,omitempty"`
+
+	// Evicts the pods of the node before its jobs run. The node is cordoned.
+	// +optional
+	Drain *DrainSpec `json:"drain,omitempty"`
+
+	// The maximum number of nodes in maintenance at once, as a number or a
+	// percentage of the nodes of the DaemonJob. Defaults to 1.
+	// +optional
+	MaxConcurrentNodes *intstr.IntOrString `json:"maxConcurrentNodes,omitempty"`
+}
+
+// RebootSpec defines how the nodes are rebooted once their job requested it
+type RebootSpec struct {
+
+	// The termination message of a container of the jobs requesting the
+	// reboot of the node. Defaults to "reboot-required".
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// The job rebooting the node, e.g. a privileged pod entering the host
+	// namespaces. It is deleted once the node rebooted.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	JobTemplate JobTemplateSpec `json:"jobTemplate"`
+
+	// Evicts the pods of the node before its reboot, else the node is only
+	// cordoned.
+	// +optional
+	Drain *DrainSpec `json:"drain,omitempty"`
+
+	// The maximum number of nodes rebooting at once, as a number or a
+	// percentage of the nodes of the DaemonJob. Defaults to 1.
+	// +optional
+	MaxConcurrentNodes *intstr.IntOrString `json:"maxConcurrentNodes,omitempty"`
+
+	// How long the node has to be Ready with a new boot ID once the reboot
+	// job is created, in seconds. Defaults to 900.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// DrainSpec defines how the pods of a node are evicted. The evictions respect
+// the PodDisruptionBudgets. The pods of DaemonSets and the mirror pods are
+// left on the node.
+type DrainSpec struct {
+
+	// The grace period of the evicted pods, in seconds. Defaults to the grace
+	// period of each pod.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+
+	// Evicts the pods using emptyDir volumes, their data is lost.
+	// +optional
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData,omitempty"`
+
+	// Evicts the pods not managed by a controller, they are not created again.
+	// +optional
+	Force bool `json:"force,omitempty"`
+}
+
+// OnSuccessSpec defines what happens on a node whose job succeeded
+type OnSuccessSpec struct {
+
+	// The labels set on the node, e.g. for other workloads to select it.
+	// They are removed when the node fails or the DaemonJob is deleted.
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// The annotations set on the node. They are removed when the node fails
+	// or the DaemonJob is deleted.
+	// +optional
+	NodeAnnotations map[string]string `json:"nodeAnnotations,omitempty"`
+
+	// The taints removed from the node once its job succeeded, e.g. a taint
+	// keeping the workloads off the nodes until they are configured. The jobs
+	// must tolerate them.
+	// +optional
+	RemoveTaints []TaintSelector `json:"removeTaints,omitempty"`
+}
+
+// TaintSelector selects the taints of a node
+type TaintSelector struct {
+
+	// The key of the taints.
+	Key string `json:"key"`
+
+	// The effect of the taints, all the effects if empty.
+	// +optional
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+}
+
+// NodeAction defines how a node whose job failed is quarantined
+type NodeAction struct {
+
+	// The taint added to the node.
+	// +optional
+	Taint *corev1.Taint `json:"taint,omitempty"`
+
+	// The labels added to the node.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// The maximum number of nodes quarantined at once, as a number or a
+	// percentage of the nodes of the DaemonJob. Defaults to 1.
+	// +optional
+	MaxQuarantinedNodes *intstr.IntOrString `json:"maxQuarantinedNodes,omitempty"`
+}
+
+// NodeConditionsSpec defines the policies of the nodes that may not run jobs
+type NodeConditionsSpec struct {
+
+	// The policy of the nodes whose Ready condition is not true.
+	// +optional
+	NotReady NodeConditionPolicy `json:"notReady,omitempty"`
+
+	// The policy of the cordoned nodes. The nodes cordoned by the
+	// maintenance of the DaemonJob are not affected.
+	// +optional
+	Unschedulable NodeConditionPolicy `json:"unschedulable,omitempty"`
+
+	// The policy of the nodes tainted ToBeDeletedByClusterAutoscaler.
+	// +optional
+	ScaleDownCandidate NodeConditionPolicy `json:"scaleDownCandidate,omitempty"`
+}
+
+// NodeConditionPolicy describes what happens on a node in a given condition
+// +kubebuilder:validation:Enum=Skip;Wait;Run
+type NodeConditionPolicy string
+
+const (
+	// NodeConditionSkip leaves the node out of the DaemonJob while in the
+	// condition, the jobs of the node run if it recovers.
+	NodeConditionSkip NodeConditionPolicy = "Skip"
+
+	// NodeConditionWait holds back the jobs of the node until it recovers.
+	NodeConditionWait NodeConditionPolicy = "Wait"
+
+	// NodeConditionRun creates the jobs of the node anyway, the default.
+	NodeConditionRun NodeConditionPolicy = "Run"
+)
+
+// DeletionPolicy describes what happens to the jobs of a deleted DaemonJob
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the jobs along with the DaemonJob.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+
+	// DeletionPolicyOrphan leaves the jobs in place, without owner.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// StepSpec defines a named job run on each node as part of spec.steps
+type StepSpec struct {
+
+	// The name of the step, unique within the DaemonJob. It suffixes the name of
+	// the jobs of the step. "check" and "verify" are reserved for the checkTemplate,
+	// "teardown" for the teardownTemplate, "on-failure" for the onFailure job and
+	// "reboot" for the reboot job.
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Specifies the job that will be created for the step.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	JobTemplate JobTemplateSpec `json:"jobTemplate"`
+}
+
+// DaemonJobReference references a DaemonJob in the same namespace
+type DaemonJobReference struct {
+
+	// The name of the DaemonJob.
+	Name string `json:"name"`
+}
+
+// ReportSpec defines how the output of a job is collected into a NodeReport
+type ReportSpec struct {
+
+	// The name of the container whose termination message holds the JSON output
+	// of the job. Defaults to the first container of the job template.
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+}
+
+// ConsistencySpec defines which part of the job output is compared across nodes
+type ConsistencySpec struct {
+
+	// A JSONPath expression selecting the value of the output that is compared
+	// across nodes, e.g. `{.sysctl.swappiness}`. Defaults to the whole output.
+	// +optional
+	JSONPath string `json:"jsonPath,omitempty"`
+}
+
+// DaemonJobStatus defines the observed state of DaemonJob
+type DaemonJobStatus struct {
+
+	// The total number of nodes that should be running the daemon
+	// job (including nodes correctly running the daemon job).
+	DesiredNumberScheduled int32 `json:"desiredNumberScheduled"`
+
+	// The number of nodes that should be running the
+	// daemon job and have one or more of the pod running and
+	// available (ready for at least spec.minReadySeconds)
+	// +optional
+	NumberAvailable *int32 `json:"numberAvailable"`
+
+	// The number of jobs that are completed.
+	// +optional
+	CompletedJobs *int32 `json:"completedJobs,omitempty"`
+
+	// The number of jobs that are failed
+	// +optional
+	FailedJobs *int32 `json:"failedJobs,omitempty"`
+
+	// The state of the DaemonJob on every node.
+	// +optional
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+
+	// The drift of the job outputs across nodes, if spec.expectConsistentOutput is set.
+	// +optional
+	Drift *DriftStatus `json:"drift,omitempty"`
+
+	// The token of the last rerun, requested with the
+	// daemon.justk8s.com/rerun annotation.
+	// +optional
+	RerunToken string `json:"rerunToken,omitempty"`
+
+	// Represents the latest available observations of the DaemonJob's state.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// NodePhase is the phase of a DaemonJob on a node
+type NodePhase string
+
+const (
+	// NodePending means no job has been created on the node yet.
+	NodePending NodePhase = "Pending"
+	// NodeRunning means the jobs of the node are running.
+	NodeRunning NodePhase = "Running"
+	// NodeSucceeded means the jobs of the node completed.
+	NodeSucceeded NodePhase = "Succeeded"
+	// NodeFailed means a job of the node failed.
+	NodeFailed NodePhase = "Failed"
+	// NodeSkipped means the node is left out by spec.nodeConditions, no job
+	// has been created on it.
+	NodeSkipped NodePhase = "Skipped"
+)
+
+// NodeCompliance is the outcome of the check job on a node
+type NodeCompliance string
+
+const (
+	// NodeCompliant means the check job succeeded, the jobTemplate did not run.
+	NodeCompliant NodeCompliance = "Compliant"
+	// NodeRemediated means the check job failed and the jobTemplate completed.
+	NodeRemediated NodeCompliance = "Remediated"
+	// NodeNonCompliant means the check job failed and the node could not be remediated.
+	NodeNonCompliant NodeCompliance = "NonCompliant"
+)
+
+// RebootPhase is the progress of the reboot of a node
+type RebootPhase string
+
+const (
+	// RebootRequired means a job of the node requested a reboot, the node
+	// waits for its turn.
+	RebootRequired RebootPhase = "Required"
+	// RebootDraining means the node is cordoned and its pods are evicted.
+	RebootDraining RebootPhase = "Draining"
+	// Rebooting means the reboot job is created, the node is not back yet.
+	Rebooting RebootPhase = "Rebooting"
+	// Rebooted means the node is Ready with a new boot ID.
+	Rebooted RebootPhase = "Rebooted"
+	// RebootFailed means the node did not come back in time, it stays cordoned.
+	RebootFailed RebootPhase = "Failed"
+)
+
+// NodeStatus defines the observed state of a DaemonJob on a node
+type NodeStatus struct {
+
+	// The name of the node.
+	NodeName string `json:"nodeName"`
+
+	// The phase of the DaemonJob on the node.
+	Phase NodePhase `json:"phase"`
+
+	// The step the node is on, if spec.steps is set.
+	// +optional
+	Step string `json:"step,omitempty"`
+
+	// Why no job is started on the node, e.g. a DaemonJob of spec.dependsOn
+	// has not succeeded on the node yet, another DaemonJob of the exclusion
+	// group is running there, the failed job waits for its retry, or the node
+	// is NotReady.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// The number of times the failed job of the node has been created again,
+	// if spec.nodeRetryPolicy is set.
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+
+	// The number of times the memory of the jobs of the node has been scaled
+	// up after an OOM kill, if spec.oomRetry is set. The later jobs of the
+	// node start with this memory.
+	// +optional
+	MemoryBumps int32 `json:"memoryBumps,omitempty"`
+
+	// The outcome of the check job on the node, if spec.checkTemplate is set.
+	// +optional
+	Compliance NodeCompliance `json:"compliance,omitempty"`
+
+	// The phase of the spec.onFailure job on the node, once the node failed.
+	// +optional
+	OnFailure NodePhase `json:"onFailure,omitempty"`
+
+	// Whether the node is quarantined by spec.onFailure.nodeAction.
+	// +optional
+	Quarantined bool `json:"quarantined,omitempty"`
+
+	// Whether the labels and annotations of spec.onSuccess are set on the node.
+	// +optional
+	Marked bool `json:"marked,omitempty"`
+
+	// Whether the node is cordoned for the maintenance of the DaemonJob.
+	// +optional
+	Cordoned bool `json:"cordoned,omitempty"`
+
+	// The progress of the reboot of the node, once its job requested it.
+	// +optional
+	Reboot RebootPhase `json:"reboot,omitempty"`
+}
+
+// DriftStatus defines the observed drift of the job outputs across nodes
+type DriftStatus struct {
+
+	// The value reported by the majority of the nodes.
+	// Empty if there is no majority.
+	// +optional
+	ExpectedValue string `json:"expectedValue,omitempty"`
+
+	// The number of nodes reporting the expected value.
+	ConsistentNodes int32 `json:"consistentNodes"`
+
+	// The nodes whose value differs from the expected value.
+	// +optional
+	DriftedNodes []DriftedNode `json:"driftedNodes,omitempty"`
+}
+
+// DriftedNode is a node whose job output differs from the majority
+type DriftedNode struct {
+
+	// The name of the node.
+	NodeName string `json:"nodeName"`
+
+	// The value reported by the node.
+	Value string `json:"value"`
+}
+
+const (
+	// DaemonJobDegraded means that some nodes are not in the state expected by the DaemonJob.
+	DaemonJobDegraded = "Degraded"
+
+	// DaemonJobJobConflict means that Jobs with the names of the DaemonJob Jobs
+	// exist, but are not owned by the DaemonJob.
+	DaemonJobJobConflict = "JobConflict"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:JSONPath=".status.desiredNumberScheduled",name="DESIRED",type="integer"
+//+kubebuilder:printcolumn:JSONPath=".status.numberAvailable",name="AVAILABLE",type="integer"
+//+kubebuilder:printcolumn:JSONPath=".status.completedJobs",name="COMPLETED",type="integer"
+//+kubebuilder:printcolumn:JSONPath=".status.failedJobs",name="Failed",type="integer"
+
+// DaemonJob is the Schema for the daemonjobs API
+type DaemonJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DaemonJobSpec   `json:"spec,omitempty"`
+	Status DaemonJobStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DaemonJobList contains a list of DaemonJob
+type DaemonJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DaemonJob `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DaemonJob{}, &DaemonJobList{})
+}
@@ -0,0 +1,419 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// MaxDaemonJobNameLength is the maximum length of a DaemonJob name. Like for
+	// a CronJob, the rest of the 63 characters of a Job name are left for the
+	// suffix of the node.
+	MaxDaemonJobNameLength = validation.DNS1035LabelMaxLength - 11
+
+	// hostnameLabel is the node label the operator sets in the nodeSelector of
+	// every job, to run it on its node.
+	hostnameLabel = "kubernetes.io/hostname"
+
+	// rerunScopeAnnotation selects the nodes rerun by the operator: all,
+	// failed, or a comma-separated list of node names.
+	rerunScopeAnnotation = "daemon.justk8s.com/rerun-scope"
+
+	// DefaultBackoffLimit is the number of retries of a job on its node when
+	// the template does not set it.
+	DefaultBackoffLimit int32 = 3
+
+	// DefaultActiveDeadlineSeconds is how long a job may run on its node when
+	// the template does not set it.
+	DefaultActiveDeadlineSeconds int64 = 3600
+
+	// DefaultNodeRetryInitialDelaySeconds is the delay before the first retry
+	// of the failed job of a node.
+	DefaultNodeRetryInitialDelaySeconds int32 = 10
+
+	// DefaultNodeRetryMultiplier is the factor the retry delay is multiplied by
+	// after each retry.
+	DefaultNodeRetryMultiplier int32 = 2
+
+	// DefaultMaxQuarantinedNodes is the number of nodes a DaemonJob may
+	// quarantine at once.
+	DefaultMaxQuarantinedNodes = 1
+
+	// DefaultMaxMaintenanceNodes is the number of nodes a DaemonJob may take
+	// out of service at once.
+	DefaultMaxMaintenanceNodes = 1
+
+	// DefaultMaxRebootingNodes is the number of nodes a DaemonJob may reboot
+	// at once.
+	DefaultMaxRebootingNodes = 1
+
+	// DefaultRebootTimeoutSeconds is how long a rebooting node may take to
+	// come back.
+	DefaultRebootTimeoutSeconds int32 = 900
+
+	// DefaultRebootMessage is the termination message of a job requesting
+	// the reboot of its node.
+	DefaultRebootMessage = "reboot-required"
+)
+
+// DefaultOOMRetryFactor is the factor the memory of the jobs of a node is
+// multiplied by after an OOM kill.
+var DefaultOOMRetryFactor = resource.MustParse("2")
+
+// log is for logging in this package.
+var daemonjoblog = logf.Log.WithName("daemonjob-resource")
+
+// SetupWebhookWithManager registers the DaemonJob webhooks in the manager.
+func (r *DaemonJob) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-daemon-justk8s-com-v1beta1-daemonjob,mutating=true,failurePolicy=fail,sideEffects=None,groups=daemon.justk8s.com,resources=daemonjobs,verbs=create;update,versions=v1beta1,name=mdaemonjob.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Defaulter = &DaemonJob{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *DaemonJob) Default() {
+	daemonjoblog.Info("default", "name", r.Name)
+
+	if len(r.Spec.JobTemplate.Spec.Template.Spec.Containers) > 0 {
+		defaultJobTemplate(&r.Spec.JobTemplate)
+	}
+	if r.Spec.CheckTemplate != nil {
+		// a failed check means the node needs the fix, not another check
+		if r.Spec.CheckTemplate.Spec.BackoffLimit == nil {
+			backoffLimit := int32(0)
+			r.Spec.CheckTemplate.Spec.BackoffLimit = &backoffLimit
+		}
+		defaultJobTemplate(r.Spec.CheckTemplate)
+	}
+	if r.Spec.TeardownTemplate != nil {
+		defaultJobTemplate(r.Spec.TeardownTemplate)
+	}
+	if r.Spec.OnFailure != nil && r.Spec.OnFailure.JobTemplate != nil {
+		defaultJobTemplate(r.Spec.OnFailure.JobTemplate)
+	}
+	if r.Spec.OnFailure != nil && r.Spec.OnFailure.NodeAction != nil && r.Spec.OnFailure.NodeAction.MaxQuarantinedNodes == nil {
+		maxQuarantinedNodes := intstr.FromInt(DefaultMaxQuarantinedNodes)
+		r.Spec.OnFailure.NodeAction.MaxQuarantinedNodes = &maxQuarantinedNodes
+	}
+	if r.Spec.Maintenance != nil && r.Spec.Maintenance.MaxConcurrentNodes == nil {
+		maxConcurrentNodes := intstr.FromInt(DefaultMaxMaintenanceNodes)
+		r.Spec.Maintenance.MaxConcurrentNodes = &maxConcurrentNodes
+	}
+	if reboot := r.Spec.Reboot; reboot != nil {
+		// a reboot job is not run again, its pod is killed by the reboot
+		backoffLimit := int32(0)
+		reboot.JobTemplate.Spec.BackoffLimit = &backoffLimit
+		reboot.JobTemplate.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+		defaultJobTemplate(&reboot.JobTemplate)
+		if reboot.Message == "" {
+			reboot.Message = DefaultRebootMessage
+		}
+		if reboot.MaxConcurrentNodes == nil {
+			maxConcurrentNodes := intstr.FromInt(DefaultMaxRebootingNodes)
+			reboot.MaxConcurrentNodes = &maxConcurrentNodes
+		}
+		if reboot.TimeoutSeconds == nil {
+			timeoutSeconds := DefaultRebootTimeoutSeconds
+			reboot.TimeoutSeconds = &timeoutSeconds
+		}
+	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyDelete
+	}
+	if policy := r.Spec.NodeRetryPolicy; policy != nil {
+		if policy.InitialDelaySeconds == nil {
+			initialDelaySeconds := DefaultNodeRetryInitialDelaySeconds
+			policy.InitialDelaySeconds = &initialDelaySeconds
+		}
+		if policy.Multiplier == 0 {
+			policy.Multiplier = DefaultNodeRetryMultiplier
+		}
+	}
+	if r.Spec.OOMRetry != nil && r.Spec.OOMRetry.Factor == nil {
+		factor := DefaultOOMRetryFactor.DeepCopy()
+		r.Spec.OOMRetry.Factor = &factor
+	}
+	for i := range r.Spec.Steps {
+		defaultJobTemplate(&r.Spec.Steps[i].JobTemplate)
+	}
+}
+
+// defaultJobTemplate sets the defaults of a job template, so that the
+// effective behavior of its jobs shows in the DaemonJob.
+func defaultJobTemplate(template *JobTemplateSpec) {
+	if template.Spec.Template.Spec.RestartPolicy == "" {
+		template.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+	}
+	if template.Spec.BackoffLimit == nil {
+		backoffLimit := DefaultBackoffLimit
+		template.Spec.BackoffLimit = &backoffLimit
+	}
+	if template.Spec.ActiveDeadlineSeconds == nil {
+		activeDeadlineSeconds := DefaultActiveDeadlineSeconds
+		template.Spec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-daemon-justk8s-com-v1beta1-daemonjob,mutating=false,failurePolicy=fail,sideEffects=None,groups=daemon.justk8s.com,resources=daemonjobs,verbs=create;update,versions=v1beta1,name=vdaemonjob.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &DaemonJob{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *DaemonJob) ValidateCreate() error {
+	daemonjoblog.Info("validate create", "name", r.Name)
+
+	return r.validateDaemonJob()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *DaemonJob) ValidateUpdate(old runtime.Object) error {
+	daemonjoblog.Info("validate update", "name", r.Name)
+
+	return r.validateDaemonJob()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *DaemonJob) ValidateDelete() error {
+	return nil
+}
+
+func (r *DaemonJob) validateDaemonJob() error {
+	var allErrs field.ErrorList
+	if len(r.Name) > MaxDaemonJobNameLength {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata").Child("name"), r.Name,
+			fmt.Sprintf("must be no more than %d characters", MaxDaemonJobNameLength)))
+	}
+	if scope, ok := r.Annotations[rerunScopeAnnotation]; ok {
+		allErrs = append(allErrs, validateRerunScope(scope,
+			field.NewPath("metadata").Child("annotations").Key(rerunScopeAnnotation))...)
+	}
+	allErrs = append(allErrs, r.validateDaemonJobSpec()...)
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("DaemonJob").GroupKind(), r.Name, allErrs)
+}
+
+func (r *DaemonJob) validateDaemonJobSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	hasJobTemplate := len(r.Spec.JobTemplate.Spec.Template.Spec.Containers) > 0
+	switch {
+	case hasJobTemplate && len(r.Spec.Steps) > 0:
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("steps"), "may not be set along with jobTemplate"))
+	case !hasJobTemplate && len(r.Spec.Steps) == 0:
+		allErrs = append(allErrs, field.Required(specPath.Child("jobTemplate"), "jobTemplate or steps is required"))
+	}
+
+	if r.Spec.NodeSelector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(r.Spec.NodeSelector, specPath.Child("nodeSelector"))...)
+	}
+
+	if hasJobTemplate {
+		allErrs = append(allErrs, validateJobTemplate(&r.Spec.JobTemplate, specPath.Child("jobTemplate"))...)
+	}
+	if r.Spec.CheckTemplate != nil {
+		allErrs = append(allErrs, validateJobTemplate(r.Spec.CheckTemplate, specPath.Child("checkTemplate"))...)
+	}
+	if r.Spec.TeardownTemplate != nil {
+		allErrs = append(allErrs, validateJobTemplate(r.Spec.TeardownTemplate, specPath.Child("teardownTemplate"))...)
+	}
+	if r.Spec.OnFailure != nil && r.Spec.OnFailure.JobTemplate != nil {
+		allErrs = append(allErrs, validateJobTemplate(r.Spec.OnFailure.JobTemplate, specPath.Child("onFailure", "jobTemplate"))...)
+	}
+	if r.Spec.OnFailure != nil && r.Spec.OnFailure.NodeAction != nil {
+		allErrs = append(allErrs, validateNodeAction(r.Spec.OnFailure.NodeAction, specPath.Child("onFailure", "nodeAction"))...)
+	}
+	if maintenance := r.Spec.Maintenance; maintenance != nil && maintenance.MaxConcurrentNodes != nil {
+		allErrs = append(allErrs, validateMaxNodes(maintenance.MaxConcurrentNodes, specPath.Child("maintenance", "maxConcurrentNodes"))...)
+	}
+	if reboot := r.Spec.Reboot; reboot != nil {
+		allErrs = append(allErrs, validateJobTemplate(&reboot.JobTemplate, specPath.Child("reboot", "jobTemplate"))...)
+		if reboot.MaxConcurrentNodes != nil {
+			allErrs = append(allErrs, validateMaxNodes(reboot.MaxConcurrentNodes, specPath.Child("reboot", "maxConcurrentNodes"))...)
+		}
+	}
+	if onSuccess := r.Spec.OnSuccess; onSuccess != nil {
+		onSuccessPath := specPath.Child("onSuccess")
+		allErrs = append(allErrs, metav1validation.ValidateLabels(onSuccess.NodeLabels, onSuccessPath.Child("nodeLabels"))...)
+		allErrs = append(allErrs, apivalidation.ValidateAnnotations(onSuccess.NodeAnnotations, onSuccessPath.Child("nodeAnnotations"))...)
+		for i, taint := range onSuccess.RemoveTaints {
+			allErrs = append(allErrs, validateTaintSelector(taint, onSuccessPath.Child("removeTaints").Index(i))...)
+		}
+	}
+	for i := range r.Spec.Steps {
+		step := &r.Spec.Steps[i]
+		stepPath := specPath.Child("steps").Index(i)
+
+		// the check, teardown, onFailure and reboot jobs are named after these stages
+		switch step.Name {
+		case "check", "verify":
+			allErrs = append(allErrs, field.Invalid(stepPath.Child("name"), step.Name, "is reserved for the checkTemplate"))
+		case "teardown":
+			allErrs = append(allErrs, field.Invalid(stepPath.Child("name"), step.Name, "is reserved for the teardownTemplate"))
+		case "on-failure":
+			allErrs = append(allErrs, field.Invalid(stepPath.Child("name"), step.Name, "is reserved for the onFailure jobTemplate"))
+		case "reboot":
+			allErrs = append(allErrs, field.Invalid(stepPath.Child("name"), step.Name, "is reserved for the reboot jobTemplate"))
+		}
+		allErrs = append(allErrs, validateJobTemplate(&step.JobTemplate, stepPath.Child("jobTemplate"))...)
+	}
+
+	if oomRetry := r.Spec.OOMRetry; oomRetry != nil {
+		oomRetryPath := specPath.Child("oomRetry")
+		if oomRetry.Factor != nil && oomRetry.Factor.MilliValue() <= 1000 {
+			allErrs = append(allErrs, field.Invalid(oomRetryPath.Child("factor"), oomRetry.Factor.String(), "must be greater than 1"))
+		}
+		if oomRetry.MaxMemory.Sign() <= 0 {
+			allErrs = append(allErrs, field.Invalid(oomRetryPath.Child("maxMemory"), oomRetry.MaxMemory.String(), "must be greater than 0"))
+		}
+	}
+
+	for i, dependency := range r.Spec.DependsOn {
+		if dependency.Name == r.Name {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("dependsOn").Index(i).Child("name"), dependency.Name,
+				"a DaemonJob can not depend on itself"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateJobTemplate validates the parts of a job template the operator relies on.
+func validateJobTemplate(template *JobTemplateSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	podSpecPath := fldPath.Child("spec", "template", "spec")
+	podSpec := &template.Spec.Template.Spec
+
+	if podSpec.RestartPolicy == corev1.RestartPolicyAlways {
+		allErrs = append(allErrs, field.NotSupported(podSpecPath.Child("restartPolicy"), podSpec.RestartPolicy,
+			[]string{string(corev1.RestartPolicyOnFailure), string(corev1.RestartPolicyNever)}))
+	}
+
+	if hostname, ok := podSpec.NodeSelector[hostnameLabel]; ok {
+		allErrs = append(allErrs, field.Invalid(podSpecPath.Child("nodeSelector").Key(hostnameLabel), hostname,
+			"is set by the operator to run the job on each node"))
+	}
+
+	return allErrs
+}
+
+// validateNodeAction validates the taint and labels quarantining a node.
+func validateNodeAction(action *NodeAction, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if action.Taint == nil && len(action.Labels) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath, "taint or labels is required"))
+	}
+
+	if taint := action.Taint; taint != nil {
+		taintPath := fldPath.Child("taint")
+		allErrs = append(allErrs, validateTaintKey(taint.Key, taintPath.Child("key"))...)
+		if taint.Value != "" {
+			for _, msg := range validation.IsValidLabelValue(taint.Value) {
+				allErrs = append(allErrs, field.Invalid(taintPath.Child("value"), taint.Value, msg))
+			}
+		}
+		allErrs = append(allErrs, validateTaintEffect(taint.Effect, taintPath.Child("effect"))...)
+	}
+
+	allErrs = append(allErrs, metav1validation.ValidateLabels(action.Labels, fldPath.Child("labels"))...)
+
+	if action.MaxQuarantinedNodes != nil {
+		allErrs = append(allErrs, validateMaxNodes(action.MaxQuarantinedNodes, fldPath.Child("maxQuarantinedNodes"))...)
+	}
+
+	return allErrs
+}
+
+// validateMaxNodes validates a number or percentage of nodes. Like the
+// maxUnavailable of a Deployment, a number above the count of nodes caps
+// nothing, but a percentage can not exceed 100%.
+func validateMaxNodes(maxNodes *intstr.IntOrString, fldPath *field.Path) field.ErrorList {
+	value, err := intstr.GetScaledValueFromIntOrPercent(maxNodes, 100, false)
+	if err != nil || value < 0 {
+		return field.ErrorList{field.Invalid(fldPath, maxNodes.String(), "must be a non-negative number or percentage")}
+	}
+	if maxNodes.Type == intstr.String && value > 100 {
+		return field.ErrorList{field.Invalid(fldPath, maxNodes.String(), "must not be greater than 100%")}
+	}
+	return nil
+}
+
+// validateTaintSelector validates the taints removed from a node.
+func validateTaintSelector(taint TaintSelector, fldPath *field.Path) field.ErrorList {
+	allErrs := validateTaintKey(taint.Key, fldPath.Child("key"))
+	if taint.Effect != "" {
+		allErrs = append(allErrs, validateTaintEffect(taint.Effect, fldPath.Child("effect"))...)
+	}
+	return allErrs
+}
+
+func validateTaintKey(key string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsQualifiedName(key) {
+		allErrs = append(allErrs, field.Invalid(fldPath, key, msg))
+	}
+	return allErrs
+}
+
+func validateTaintEffect(effect corev1.TaintEffect, fldPath *field.Path) field.ErrorList {
+	switch effect {
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		return nil
+	}
+	return field.ErrorList{field.NotSupported(fldPath, effect,
+		[]string{string(corev1.TaintEffectNoSchedule), string(corev1.TaintEffectPreferNoSchedule), string(corev1.TaintEffectNoExecute)})}
+}
+
+// validateRerunScope validates the nodes selected by a rerun.
+func validateRerunScope(scope string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if scope == "all" || scope == "failed" {
+		return allErrs
+	}
+
+	for _, nodeName := range strings.Split(scope, ",") {
+		for _, msg := range validation.IsDNS1123Subdomain(strings.TrimSpace(nodeName)) {
+			allErrs = append(allErrs, field.Invalid(fldPath, scope,
+				fmt.Sprintf("must be all, failed or a comma-separated list of node names: %s", msg)))
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("DaemonJob webhook", func() {
+
+	var daemonJob *DaemonJob
+
+	BeforeEach(func() {
+		daemonJob = &DaemonJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "daemonjob-sample", Namespace: "default"},
+			Spec: DaemonJobSpec{
+				JobTemplate: JobTemplateSpec{
+					Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								Containers:    []corev1.Container{{Name: "hello", Image: "busybox"}},
+								RestartPolicy: corev1.RestartPolicyOnFailure,
+							},
+						},
+					},
+				},
+			},
+		}
+	})
+
+	It("should accept a valid DaemonJob", func() {
+		Expect(daemonJob.ValidateCreate()).To(Succeed())
+	})
+
+	It("should reject a restartPolicy Always", func() {
+		daemonJob.Spec.JobTemplate.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.jobTemplate.spec.template.spec.restartPolicy"))
+	})
+
+	It("should reject a nodeSelector on the hostname", func() {
+		daemonJob.Spec.JobTemplate.Spec.Template.Spec.NodeSelector = map[string]string{hostnameLabel: "worker-1"}
+
+		err := daemonJob.ValidateUpdate(daemonJob.DeepCopy())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(hostnameLabel))
+	})
+
+	It("should reject an invalid nodeSelector", func() {
+		daemonJob.Spec.NodeSelector = &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "kubernetes.io/os", Operator: metav1.LabelSelectorOpIn},
+			},
+		}
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.nodeSelector"))
+	})
+
+	It("should accept a nodeSelector selecting and ignoring nodes", func() {
+		daemonJob.Spec.NodeSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{"kubernetes.io/os": "linux"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "node-role.kubernetes.io/control-plane", Operator: metav1.LabelSelectorOpDoesNotExist},
+			},
+		}
+
+		Expect(daemonJob.ValidateCreate()).To(Succeed())
+	})
+
+	It("should validate the rerun scope", func() {
+		daemonJob.Annotations = map[string]string{rerunScopeAnnotation: "worker-1, worker-2"}
+		Expect(daemonJob.ValidateUpdate(daemonJob.DeepCopy())).To(Succeed())
+
+		daemonJob.Annotations[rerunScopeAnnotation] = "failed-nodes!"
+		err := daemonJob.ValidateUpdate(daemonJob.DeepCopy())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(rerunScopeAnnotation))
+	})
+
+	It("should reject a name too long for the Job names", func() {
+		daemonJob.Name = strings.Repeat("a", MaxDaemonJobNameLength+1)
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("metadata.name"))
+	})
+
+	It("should reject the step names reserved for the checkTemplate", func() {
+		daemonJob.Spec.Steps = []StepSpec{{Name: "check", JobTemplate: daemonJob.Spec.JobTemplate}}
+		daemonJob.Spec.JobTemplate = JobTemplateSpec{}
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.steps[0].name"))
+	})
+
+	It("should reject the step name reserved for the teardownTemplate", func() {
+		daemonJob.Spec.Steps = []StepSpec{{Name: "teardown", JobTemplate: daemonJob.Spec.JobTemplate}}
+		daemonJob.Spec.JobTemplate = JobTemplateSpec{}
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("teardownTemplate"))
+	})
+	It("should reject the step name reserved for the onFailure job", func() {
+		daemonJob.Spec.Steps = []StepSpec{{Name: "on-failure", JobTemplate: daemonJob.Spec.JobTemplate}}
+		daemonJob.Spec.JobTemplate = JobTemplateSpec{}
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("onFailure"))
+	})
+
+	It("should validate the quarantine of the failed nodes", func() {
+		daemonJob.Spec.OnFailure = &OnFailureSpec{NodeAction: &NodeAction{}}
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.onFailure.nodeAction"))
+
+		daemonJob.Spec.OnFailure.NodeAction.Taint = &corev1.Taint{Key: "hardening.example.com/failed", Effect: "NoRun"}
+		err = daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.onFailure.nodeAction.taint.effect"))
+
+		daemonJob.Spec.OnFailure.NodeAction.Taint.Effect = corev1.TaintEffectNoSchedule
+		Expect(daemonJob.ValidateCreate()).To(Succeed())
+	})
+
+	It("should reject invalid node labels on success", func() {
+		daemonJob.Spec.OnSuccess = &OnSuccessSpec{NodeLabels: map[string]string{"gpu-driver.example.com/installed": "v535 beta"}}
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.onSuccess.nodeLabels"))
+	})
+
+	It("should reject an OOM retry factor that does not grow the memory", func() {
+		factor := resource.MustParse("1")
+		daemonJob.Spec.OOMRetry = &OOMRetry{Factor: &factor, MaxMemory: resource.MustParse("1Gi")}
+
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.oomRetry.factor"))
+	})
+
+	It("should default the node retry policy", func() {
+		daemonJob.Spec.NodeRetryPolicy = &NodeRetryPolicy{MaxRetries: 3}
+		daemonJob.Default()
+		Expect(*daemonJob.Spec.NodeRetryPolicy.InitialDelaySeconds).To(Equal(DefaultNodeRetryInitialDelaySeconds))
+		Expect(daemonJob.Spec.NodeRetryPolicy.Multiplier).To(Equal(DefaultNodeRetryMultiplier))
+
+		initialDelaySeconds := int32(0)
+		daemonJob.Spec.NodeRetryPolicy.InitialDelaySeconds = &initialDelaySeconds
+		daemonJob.Default()
+		Expect(*daemonJob.Spec.NodeRetryPolicy.InitialDelaySeconds).To(BeZero())
+	})
+
+	It("should default and validate the nodes in maintenance", func() {
+		daemonJob.Spec.Maintenance = &MaintenanceSpec{Cordon: true}
+		daemonJob.Default()
+		Expect(daemonJob.Spec.Maintenance.MaxConcurrentNodes.IntValue()).To(Equal(DefaultMaxMaintenanceNodes))
+
+		maxConcurrentNodes := intstr.FromString("all")
+		daemonJob.Spec.Maintenance.MaxConcurrentNodes = &maxConcurrentNodes
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.maintenance.maxConcurrentNodes"))
+
+		maxConcurrentNodes = intstr.FromString("250%")
+		err = daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("must not be greater than 100%"))
+
+		maxConcurrentNodes = intstr.FromString("100%")
+		Expect(daemonJob.ValidateCreate()).To(Succeed())
+	})
+
+	It("should default the reboot of the nodes", func() {
+		daemonJob.Spec.Reboot = &RebootSpec{JobTemplate: daemonJob.Spec.JobTemplate}
+		daemonJob.Default()
+
+		Expect(daemonJob.Spec.Reboot.Message).To(Equal(DefaultRebootMessage))
+		Expect(*daemonJob.Spec.Reboot.TimeoutSeconds).To(Equal(DefaultRebootTimeoutSeconds))
+		Expect(daemonJob.Spec.Reboot.MaxConcurrentNodes.IntValue()).To(Equal(DefaultMaxRebootingNodes))
+		Expect(*daemonJob.Spec.Reboot.JobTemplate.Spec.BackoffLimit).To(BeZero())
+		Expect(daemonJob.Spec.Reboot.JobTemplate.Spec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyNever))
+		Expect(daemonJob.ValidateCreate()).To(Succeed())
+
+		daemonJob.Spec.Steps = []StepSpec{{Name: "reboot", JobTemplate: daemonJob.Spec.JobTemplate}}
+		err := daemonJob.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("is reserved for the reboot jobTemplate"))
+	})
+
+	It("should default the job templates", func() {
+		daemonJob.Spec.JobTemplate.Spec.Template.Spec.RestartPolicy = ""
+		daemonJob.Spec.Steps = []StepSpec{{Name: "apply"}}
+		daemonJob.Spec.Steps[0].JobTemplate.Spec.BackoffLimit = new(int32)
+
+		daemonJob.Default()
+
+		jobSpec := daemonJob.Spec.JobTemplate.Spec
+		Expect(jobSpec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyOnFailure))
+		Expect(*jobSpec.BackoffLimit).To(Equal(DefaultBackoffLimit))
+		Expect(*jobSpec.ActiveDeadlineSeconds).To(Equal(DefaultActiveDeadlineSeconds))
+
+		By("keeping the fields set by the user")
+		Expect(*daemonJob.Spec.Steps[0].JobTemplate.Spec.BackoffLimit).To(BeZero())
+	})
+
+	It("should not retry the check jobs", func() {
+		daemonJob.Spec.CheckTemplate = daemonJob.Spec.JobTemplate.DeepCopy()
+		daemonJob.Default()
+		Expect(*daemonJob.Spec.CheckTemplate.Spec.BackoffLimit).To(BeZero())
+
+		backoffLimit := int32(2)
+		daemonJob.Spec.CheckTemplate.Spec.BackoffLimit = &backoffLimit
+		daemonJob.Default()
+		Expect(*daemonJob.Spec.CheckTemplate.Spec.BackoffLimit).To(Equal(backoffLimit))
+	})
+})
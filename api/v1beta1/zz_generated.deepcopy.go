@@ -0,0 +1,588 @@
+// +build !ignore_autogenerated
+
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsistencySpec) DeepCopyInto(out *ConsistencySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsistencySpec.
+func (in *ConsistencySpec) DeepCopy() *ConsistencySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsistencySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DaemonJob) DeepCopyInto(out *DaemonJob) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJob.
+func (in *DaemonJob) DeepCopy() *DaemonJob {
+	if in == nil {
+		return nil
+	}
+	out := new(DaemonJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DaemonJob) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DaemonJobList) DeepCopyInto(out *DaemonJobList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DaemonJob, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJobList.
+func (in *DaemonJobList) DeepCopy() *DaemonJobList {
+	if in == nil {
+		return nil
+	}
+	out := new(DaemonJobList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DaemonJobList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DaemonJobReference) DeepCopyInto(out *DaemonJobReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJobReference.
+func (in *DaemonJobReference) DeepCopy() *DaemonJobReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DaemonJobReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DaemonJobSpec) DeepCopyInto(out *DaemonJobSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeConditions != nil {
+		in, out := &in.NodeConditions, &out.NodeConditions
+		*out = new(NodeConditionsSpec)
+		**out = **in
+	}
+	in.JobTemplate.DeepCopyInto(&out.JobTemplate)
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]StepSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CheckTemplate != nil {
+		in, out := &in.CheckTemplate, &out.CheckTemplate
+		*out = new(JobTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]DaemonJobReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Report != nil {
+		in, out := &in.Report, &out.Report
+		*out = new(ReportSpec)
+		**out = **in
+	}
+	if in.ExpectConsistentOutput != nil {
+		in, out := &in.ExpectConsistentOutput, &out.ExpectConsistentOutput
+		*out = new(ConsistencySpec)
+		**out = **in
+	}
+	if in.TeardownTemplate != nil {
+		in, out := &in.TeardownTemplate, &out.TeardownTemplate
+		*out = new(JobTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeRetryPolicy != nil {
+		in, out := &in.NodeRetryPolicy, &out.NodeRetryPolicy
+		*out = new(NodeRetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OOMRetry != nil {
+		in, out := &in.OOMRetry, &out.OOMRetry
+		*out = new(OOMRetry)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OnFailure != nil {
+		in, out := &in.OnFailure, &out.OnFailure
+		*out = new(OnFailureSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OnSuccess != nil {
+		in, out := &in.OnSuccess, &out.OnSuccess
+		*out = new(OnSuccessSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Maintenance != nil {
+		in, out := &in.Maintenance, &out.Maintenance
+		*out = new(MaintenanceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Reboot != nil {
+		in, out := &in.Reboot, &out.Reboot
+		*out = new(RebootSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJobSpec.
+func (in *DaemonJobSpec) DeepCopy() *DaemonJobSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DaemonJobSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DaemonJobStatus) DeepCopyInto(out *DaemonJobStatus) {
+	*out = *in
+	if in.NumberAvailable != nil {
+		in, out := &in.NumberAvailable, &out.NumberAvailable
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CompletedJobs != nil {
+		in, out := &in.CompletedJobs, &out.CompletedJobs
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedJobs != nil {
+		in, out := &in.FailedJobs, &out.FailedJobs
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = new(DriftStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonJobStatus.
+func (in *DaemonJobStatus) DeepCopy() *DaemonJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DaemonJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DrainSpec) DeepCopyInto(out *DrainSpec) {
+	*out = *in
+	if in.GracePeriodSeconds != nil {
+		in, out := &in.GracePeriodSeconds, &out.GracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DrainSpec.
+func (in *DrainSpec) DeepCopy() *DrainSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DrainSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftStatus) DeepCopyInto(out *DriftStatus) {
+	*out = *in
+	if in.DriftedNodes != nil {
+		in, out := &in.DriftedNodes, &out.DriftedNodes
+		*out = make([]DriftedNode, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftStatus.
+func (in *DriftStatus) DeepCopy() *DriftStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftedNode) DeepCopyInto(out *DriftedNode) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftedNode.
+func (in *DriftedNode) DeepCopy() *DriftedNode {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftedNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobTemplateSpec) DeepCopyInto(out *JobTemplateSpec) {
+	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobTemplateSpec.
+func (in *JobTemplateSpec) DeepCopy() *JobTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(JobTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceSpec) DeepCopyInto(out *MaintenanceSpec) {
+	*out = *in
+	if in.Drain != nil {
+		in, out := &in.Drain, &out.Drain
+		*out = new(DrainSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxConcurrentNodes != nil {
+		in, out := &in.MaxConcurrentNodes, &out.MaxConcurrentNodes
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceSpec.
+func (in *MaintenanceSpec) DeepCopy() *MaintenanceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeAction) DeepCopyInto(out *NodeAction) {
+	*out = *in
+	if in.Taint != nil {
+		in, out := &in.Taint, &out.Taint
+		*out = new(corev1.Taint)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.MaxQuarantinedNodes != nil {
+		in, out := &in.MaxQuarantinedNodes, &out.MaxQuarantinedNodes
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeAction.
+func (in *NodeAction) DeepCopy() *NodeAction {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeConditionsSpec) DeepCopyInto(out *NodeConditionsSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeConditionsSpec.
+func (in *NodeConditionsSpec) DeepCopy() *NodeConditionsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeConditionsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeRetryPolicy) DeepCopyInto(out *NodeRetryPolicy) {
+	*out = *in
+	if in.InitialDelaySeconds != nil {
+		in, out := &in.InitialDelaySeconds, &out.InitialDelaySeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeRetryPolicy.
+func (in *NodeRetryPolicy) DeepCopy() *NodeRetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeRetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeStatus) DeepCopyInto(out *NodeStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeStatus.
+func (in *NodeStatus) DeepCopy() *NodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OOMRetry) DeepCopyInto(out *OOMRetry) {
+	*out = *in
+	if in.Factor != nil {
+		in, out := &in.Factor, &out.Factor
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	out.MaxMemory = in.MaxMemory.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OOMRetry.
+func (in *OOMRetry) DeepCopy() *OOMRetry {
+	if in == nil {
+		return nil
+	}
+	out := new(OOMRetry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OnFailureSpec) DeepCopyInto(out *OnFailureSpec) {
+	*out = *in
+	if in.JobTemplate != nil {
+		in, out := &in.JobTemplate, &out.JobTemplate
+		*out = new(JobTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeAction != nil {
+		in, out := &in.NodeAction, &out.NodeAction
+		*out = new(NodeAction)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OnFailureSpec.
+func (in *OnFailureSpec) DeepCopy() *OnFailureSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OnFailureSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OnSuccessSpec) DeepCopyInto(out *OnSuccessSpec) {
+	*out = *in
+	if in.NodeLabels != nil {
+		in, out := &in.NodeLabels, &out.NodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeAnnotations != nil {
+		in, out := &in.NodeAnnotations, &out.NodeAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RemoveTaints != nil {
+		in, out := &in.RemoveTaints, &out.RemoveTaints
+		*out = make([]TaintSelector, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OnSuccessSpec.
+func (in *OnSuccessSpec) DeepCopy() *OnSuccessSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OnSuccessSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RebootSpec) DeepCopyInto(out *RebootSpec) {
+	*out = *in
+	in.JobTemplate.DeepCopyInto(&out.JobTemplate)
+	if in.Drain != nil {
+		in, out := &in.Drain, &out.Drain
+		*out = new(DrainSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxConcurrentNodes != nil {
+		in, out := &in.MaxConcurrentNodes, &out.MaxConcurrentNodes
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RebootSpec.
+func (in *RebootSpec) DeepCopy() *RebootSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RebootSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReportSpec) DeepCopyInto(out *ReportSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReportSpec.
+func (in *ReportSpec) DeepCopy() *ReportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StepSpec) DeepCopyInto(out *StepSpec) {
+	*out = *in
+	in.JobTemplate.DeepCopyInto(&out.JobTemplate)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StepSpec.
+func (in *StepSpec) DeepCopy() *StepSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StepSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TaintSelector) DeepCopyInto(out *TaintSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TaintSelector.
+func (in *TaintSelector) DeepCopy() *TaintSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(TaintSelector)
+	in.DeepCopyInto(out)
+	return out
+}
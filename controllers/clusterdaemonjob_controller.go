@@ -0,0 +1,310 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var (
+	// The Jobs of a ClusterDaemonJob can not have it as controller, they are
+	// selected by label and mapped back to it by annotation.
+	clusterDaemonJobLabel      = "daemon.justk8s.com/clusterdaemonjob"
+	clusterDaemonJobAnnotation = "daemon.justk8s.com/clusterdaemonjob"
+	clusterDaemonJobFinalizer  = "daemon.justk8s.com/cluster-cleanup"
+
+	// targetNamespaceRequeueDelay is how long a ClusterDaemonJob waits before
+	// checking again its missing target namespace.
+	targetNamespaceRequeueDelay = 30 * time.Second
+
+	eventReasonTargetNamespaceNotFound = "TargetNamespaceNotFound"
+)
+
+// ClusterDaemonJobReconciler reconciles a ClusterDaemonJob object
+type ClusterDaemonJobReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// DaemonJobs is the DaemonJob reconciler, whose Job logic and admission
+	// state are shared with the ClusterDaemonJobs.
+	DaemonJobs *DaemonJobReconciler
+}
+
+//+kubebuilder:rbac:groups=daemon.justk8s.com,resources=clusterdaemonjobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=daemon.justk8s.com,resources=clusterdaemonjobs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=daemon.justk8s.com,resources=clusterdaemonjobs/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+
+// Reconcile creates the Jobs of a ClusterDaemonJob in its target namespace,
+// and deletes them once the ClusterDaemonJob is deleted.
+func (r *ClusterDaemonJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := clog.FromContext(ctx)
+
+	log.Info("reconciling ClusterDaemonJob")
+
+	// Retrieve ClusterDaemonJob object
+	var clusterDaemonJob daemonv1alpha1.ClusterDaemonJob
+	if err := r.Get(ctx, req.NamespacedName, &clusterDaemonJob); err != nil {
+		log.Error(err, "unable to fetch ClusterDaemonJob")
+		if errors.IsNotFound(err) {
+			r.DaemonJobs.admission.forget(req.NamespacedName)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Retrieve childJobs, in every namespace
+	var childJobs batchv1.JobList
+	if err := r.List(ctx, &childJobs,
+		client.MatchingLabels{clusterDaemonJobLabel: labelValue(clusterDaemonJob.Name)}); err != nil {
+		log.Error(err, "unable to list child Jobs")
+		return ctrl.Result{}, err
+	}
+
+	// Delete the Jobs before letting the ClusterDaemonJob go
+	if !clusterDaemonJob.DeletionTimestamp.IsZero() {
+		if err := r.deleteJobs(ctx, childJobs.Items); err != nil {
+			log.Error(err, "unable to delete child Jobs")
+			return ctrl.Result{}, err
+		}
+
+		controllerutil.RemoveFinalizer(&clusterDaemonJob, clusterDaemonJobFinalizer)
+		return ctrl.Result{}, r.Update(ctx, &clusterDaemonJob)
+	}
+
+	if !controllerutil.ContainsFinalizer(&clusterDaemonJob, clusterDaemonJobFinalizer) {
+		controllerutil.AddFinalizer(&clusterDaemonJob, clusterDaemonJobFinalizer)
+		return ctrl.Result{}, r.Update(ctx, &clusterDaemonJob)
+	}
+
+	// Wait for the target namespace, rather than fail to create the Jobs
+	var namespace v1.Namespace
+	if err := r.DaemonJobs.APIReader.Get(ctx, client.ObjectKey{Name: clusterDaemonJob.Spec.TargetNamespace}, &namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			log.Error(err, "unable to fetch target namespace")
+			return ctrl.Result{}, err
+		}
+		r.DaemonJobs.Recorder.Eventf(&clusterDaemonJob, v1.EventTypeWarning, eventReasonTargetNamespaceNotFound,
+			"Target namespace %s not found", clusterDaemonJob.Spec.TargetNamespace)
+		return ctrl.Result{RequeueAfter: targetNamespaceRequeueDelay}, nil
+	}
+
+	// The Jobs left in a previous target namespace are deleted
+	var targetJobs batchv1.JobList
+	var staleJobs []batchv1.Job
+	for _, job := range childJobs.Items {
+		if job.Namespace == clusterDaemonJob.Spec.TargetNamespace {
+			targetJobs.Items = append(targetJobs.Items, job)
+		} else {
+			staleJobs = append(staleJobs, job)
+		}
+	}
+	if err := r.deleteJobs(ctx, staleJobs); err != nil {
+		log.Error(err, "unable to delete Jobs of a previous target namespace")
+		return ctrl.Result{}, err
+	}
+
+	// Get List of all nodes
+	nodeList, err := r.DaemonJobs.listNodes(ctx)
+	if err != nil {
+		log.Error(err, "unable to list nodes")
+		return ctrl.Result{}, err
+	}
+
+	// The Jobs are handled like the ones of a DaemonJob in the target namespace
+	daemonJob, err := daemonJobForClusterDaemonJob(&clusterDaemonJob)
+	if err != nil {
+		log.Error(err, "unable to convert ClusterDaemonJob")
+		return ctrl.Result{}, err
+	}
+	jobs := jobsByNode(&targetJobs)
+
+	// Hold back the nodes where another DaemonJob of the exclusion group is
+	// running, the group being locked until the Jobs are created
+	unlock := r.DaemonJobs.exclusion.lock(daemonJob.Spec.ExclusionGroup)
+	defer unlock()
+	holds := make(map[string]string)
+	excluded, err := r.DaemonJobs.exclusionHolds(ctx, daemonJob, holds)
+	if err != nil {
+		log.Error(err, "unable to check ClusterDaemonJob exclusion group")
+		return ctrl.Result{}, err
+	}
+
+	// desiredJobs
+	desiredJobs := r.DaemonJobs.desiredJobsForDaemonJob(daemonJob.Namespace, daemonJob, nodeList, jobs, holds)
+
+	// hold back the nodes whose Job name is taken by a foreign Job
+	desiredJobs, conflicts, err := r.DaemonJobs.jobConflicts(ctx, desiredJobs, holds, func(job *batchv1.Job) bool {
+		return job.Labels[clusterDaemonJobLabel] == labelValue(clusterDaemonJob.Name)
+	})
+	if err != nil {
+		log.Error(err, "unable to check desired jobs conflicts")
+		return ctrl.Result{}, err
+	}
+	r.DaemonJobs.recordConflicts(&clusterDaemonJob, conflicts)
+
+	// admit the desired Jobs within the operator-wide limit
+	admittedJobs, err := r.DaemonJobs.admitJobs(ctx, req.NamespacedName, clusterDaemonJob.Spec.Priority, desiredJobs, holds)
+	if err != nil {
+		log.Error(err, "unable to admit desired jobs")
+		return ctrl.Result{}, err
+	}
+
+	// update status
+	djStatus := r.DaemonJobs.daemonJobStatus(daemonJob, jobs, holds, nodeList)
+	setConflictStatus(djStatus, conflicts)
+	status, err := clusterDaemonJobStatus(djStatus)
+	if err != nil {
+		log.Error(err, "unable to convert ClusterDaemonJob status")
+		return ctrl.Result{}, err
+	}
+	if !reflect.DeepEqual(*status, clusterDaemonJob.Status) {
+		log.Info("Updating cluster daemon job status")
+		clusterDaemonJob.Status = *status
+		if err := r.Status().Update(ctx, &clusterDaemonJob); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// create desired Jobs
+	for _, job := range admittedJobs {
+		job.Labels[clusterDaemonJobLabel] = labelValue(clusterDaemonJob.Name)
+		job.Annotations[clusterDaemonJobAnnotation] = clusterDaemonJob.Name
+
+		if err := r.Create(ctx, job); err != nil && errors.IsAlreadyExists(err) {
+			log.Info("desired Job already exists")
+		} else if err != nil {
+			log.Error(err, "error creating desired jobs")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Check again later the nodes locked by the exclusion group
+	if excluded {
+		return ctrl.Result{RequeueAfter: exclusionRequeueDelay}, nil
+	}
+
+	// Ask again later for the slots of the Jobs not admitted
+	if len(admittedJobs) < len(desiredJobs) {
+		return ctrl.Result{RequeueAfter: admissionRequeueDelay}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// daemonJobForClusterDaemonJob returns the DaemonJob equivalent to the
+// ClusterDaemonJob, in its target namespace.
+func daemonJobForClusterDaemonJob(cdj *daemonv1alpha1.ClusterDaemonJob) (*daemonv1beta1.DaemonJob, error) {
+	daemonJob := &daemonv1alpha1.DaemonJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cdj.Name,
+			Namespace: cdj.Spec.TargetNamespace,
+			UID:       cdj.UID,
+		},
+		Spec: daemonv1alpha1.DaemonJobSpec{
+			JobTemplate:    cdj.Spec.JobTemplate,
+			Steps:          cdj.Spec.Steps,
+			CheckTemplate:  cdj.Spec.CheckTemplate,
+			VerifyAfterFix: cdj.Spec.VerifyAfterFix,
+			ExclusionGroup: cdj.Spec.ExclusionGroup,
+			Priority:       cdj.Spec.Priority,
+		},
+		Status: cdj.Status,
+	}
+
+	// the Jobs are handled by the DaemonJob logic, on the hub version
+	hub := &daemonv1beta1.DaemonJob{}
+	if err := daemonJob.ConvertTo(hub); err != nil {
+		return nil, err
+	}
+
+	return hub, nil
+}
+
+// clusterDaemonJobStatus converts the status computed for the DaemonJob
+// equivalent to the ClusterDaemonJob back.
+func clusterDaemonJobStatus(status *daemonv1beta1.DaemonJobStatus) (*daemonv1alpha1.DaemonJobStatus, error) {
+	daemonJob := &daemonv1alpha1.DaemonJob{}
+	if err := daemonJob.ConvertFrom(&daemonv1beta1.DaemonJob{Status: *status}); err != nil {
+		return nil, err
+	}
+
+	return &daemonJob.Status, nil
+}
+
+// deleteJobs deletes the Jobs along with their pods
+func (r *ClusterDaemonJobReconciler) deleteJobs(ctx context.Context, jobs []batchv1.Job) error {
+	for i := range jobs {
+		if err := r.Delete(ctx, &jobs[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *ClusterDaemonJobReconciler) mapJobToClusterDaemonJob(obj client.Object) []ctrl.Request {
+	name, ok := obj.GetAnnotations()[clusterDaemonJobAnnotation]
+	if !ok {
+		return nil
+	}
+
+	return []ctrl.Request{{NamespacedName: types.NamespacedName{Name: name}}}
+}
+
+func (r *ClusterDaemonJobReconciler) mapToClusterDaemonJob(_ client.Object) []ctrl.Request {
+	ctx := context.Background()
+	log := clog.FromContext(ctx)
+	clusterDaemonJobList := &daemonv1alpha1.ClusterDaemonJobList{}
+	if err := r.List(ctx, clusterDaemonJobList); err != nil {
+		log.Error(err, "error getting list of ClusterDaemonJob")
+		return nil
+	}
+
+	results := make([]ctrl.Request, 0, len(clusterDaemonJobList.Items))
+	for _, clusterDaemonJob := range clusterDaemonJobList.Items {
+		results = append(results, ctrl.Request{
+			NamespacedName: client.ObjectKey{Name: clusterDaemonJob.GetName()},
+		})
+	}
+	return results
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterDaemonJobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&daemonv1alpha1.ClusterDaemonJob{}).
+		Watches(&source.Kind{Type: &v1.Node{}}, handler.EnqueueRequestsFromMapFunc(r.mapToClusterDaemonJob)).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(r.mapJobToClusterDaemonJob)).
+		Complete(r)
+}
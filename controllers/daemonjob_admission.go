@@ -0,0 +1,170 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// admissionRequeueDelay is how long a DaemonJob waits before asking
+	// again for slots when the operator runs its maximum of active Jobs.
+	admissionRequeueDelay = 10 * time.Second
+
+	// admittedJobTTL is how long an admitted Job counts as active while it
+	// does not show up in the cache, e.g. because its creation failed.
+	admittedJobTTL = time.Minute
+)
+
+// jobAdmission limits the number of active Jobs across all DaemonJobs. It is
+// shared by the reconciles, which ask it for slots before creating Jobs.
+type jobAdmission struct {
+	mu sync.Mutex
+
+	// maxActiveJobs is the maximum number of active Jobs, 0 means no limit
+	maxActiveJobs int
+
+	// admitted are the Jobs given a slot that are not in the cache yet
+	admitted map[types.NamespacedName]time.Time
+
+	// waiting are the DaemonJobs waiting for slots, with their priority
+	waiting map[types.NamespacedName]int32
+}
+
+func newJobAdmission(maxActiveJobs int) *jobAdmission {
+	return &jobAdmission{
+		maxActiveJobs: maxActiveJobs,
+		admitted:      make(map[types.NamespacedName]time.Time),
+		waiting:       make(map[types.NamespacedName]int32),
+	}
+}
+
+// admit returns the desired Jobs of the DaemonJob that fit in the free slots.
+// The slots go to the DaemonJob with the highest priority first: a DaemonJob
+// gets no slot while a DaemonJob with a higher priority is waiting for one.
+func (a *jobAdmission) admit(key types.NamespacedName, priority int32, desiredJobs []*batchv1.Job, jobs *batchv1.JobList) []*batchv1.Job {
+	if a.maxActiveJobs <= 0 {
+		return desiredJobs
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(desiredJobs) == 0 {
+		delete(a.waiting, key)
+		return desiredJobs
+	}
+
+	free := a.maxActiveJobs - a.activeJobs(jobs)
+	for other, waitingPriority := range a.waiting {
+		if other != key && waitingPriority > priority {
+			free = 0
+			break
+		}
+	}
+	if free < 0 {
+		free = 0
+	}
+
+	admitted := desiredJobs
+	if len(desiredJobs) > free {
+		admitted = desiredJobs[:free]
+		a.waiting[key] = priority
+	} else {
+		delete(a.waiting, key)
+	}
+
+	now := time.Now()
+	for _, job := range admitted {
+		a.admitted[types.NamespacedName{Namespace: job.Namespace, Name: job.Name}] = now
+	}
+
+	return admitted
+}
+
+// forget drops a deleted DaemonJob from the waiting DaemonJobs.
+func (a *jobAdmission) forget(key types.NamespacedName) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.waiting, key)
+}
+
+// activeJobs counts the active Jobs of all DaemonJobs and ClusterDaemonJobs,
+// including the admitted Jobs that are not in the cache yet.
+func (a *jobAdmission) activeJobs(jobs *batchv1.JobList) int {
+	active := 0
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		delete(a.admitted, types.NamespacedName{Namespace: job.Namespace, Name: job.Name})
+
+		if !isDaemonJobChild(job) {
+			continue
+		}
+		if jobStatus(*job) == "" {
+			active++
+		}
+	}
+
+	for job, admittedAt := range a.admitted {
+		if time.Since(admittedAt) > admittedJobTTL {
+			delete(a.admitted, job)
+			continue
+		}
+		active++
+	}
+
+	return active
+}
+
+// isDaemonJobChild returns whether the Job has been created by a DaemonJob or
+// a ClusterDaemonJob.
+func isDaemonJobChild(job *batchv1.Job) bool {
+	if _, ok := job.Labels[clusterDaemonJobLabel]; ok {
+		return true
+	}
+
+	return isDaemonJobOwner(metav1.GetControllerOf(job))
+}
+
+// admitJobs returns the desired Jobs admitted by the operator-wide limit, and
+// holds back the nodes of the other ones. The key identifies the DaemonJob or
+// ClusterDaemonJob asking for slots.
+func (r *DaemonJobReconciler) admitJobs(ctx context.Context, key types.NamespacedName, priority int32, desiredJobs []*batchv1.Job, holds map[string]string) ([]*batchv1.Job, error) {
+	if r.MaxActiveJobs <= 0 {
+		return desiredJobs, nil
+	}
+
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs); err != nil {
+		return nil, err
+	}
+
+	admitted := r.admission.admit(key, priority, desiredJobs, &jobs)
+	for _, job := range desiredJobs[len(admitted):] {
+		holds[job.Annotations[annotation]] = fmt.Sprintf("waiting for one of the %d active Job slots of the operator", r.MaxActiveJobs)
+	}
+
+	return admitted, nil
+}
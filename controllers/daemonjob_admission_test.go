@@ -0,0 +1,93 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Job admission", func() {
+
+	daemonJob := func(name string, priority int32) *daemonv1beta1.DaemonJob {
+		return &daemonv1beta1.DaemonJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Spec:       daemonv1beta1.DaemonJobSpec{Priority: priority},
+		}
+	}
+
+	key := func(dj *daemonv1beta1.DaemonJob) types.NamespacedName {
+		return types.NamespacedName{Namespace: dj.Namespace, Name: dj.Name}
+	}
+
+	desiredJobs := func(dj *daemonv1beta1.DaemonJob, count int) []*batchv1.Job {
+		jobs := make([]*batchv1.Job, 0, count)
+		for i := 0; i < count; i++ {
+			jobs = append(jobs, &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-node-%d", dj.Name, i), Namespace: dj.Namespace},
+			})
+		}
+		return jobs
+	}
+
+	It("should admit every Job without a limit", func() {
+		admission := newJobAdmission(0)
+		inventory := daemonJob("inventory", 0)
+
+		Expect(admission.admit(key(inventory), 0, desiredJobs(inventory, 5), &batchv1.JobList{})).To(HaveLen(5))
+	})
+
+	It("should count the admitted Jobs not in the cache yet", func() {
+		admission := newJobAdmission(3)
+		inventory := daemonJob("inventory", 0)
+
+		Expect(admission.admit(key(inventory), 0, desiredJobs(inventory, 2), &batchv1.JobList{})).To(HaveLen(2))
+
+		other := daemonJob("other", 0)
+		Expect(admission.admit(key(other), 0, desiredJobs(other, 2), &batchv1.JobList{})).To(HaveLen(1))
+	})
+
+	It("should give the free slots to the highest priority first", func() {
+		admission := newJobAdmission(1)
+		inventory := daemonJob("inventory", 0)
+		patch := daemonJob("security-patch", 100)
+
+		By("filling the slots")
+		first := admission.admit(key(inventory), 0, desiredJobs(inventory, 2), &batchv1.JobList{})
+		Expect(first).To(HaveLen(1))
+
+		By("queueing the urgent DaemonJob")
+		Expect(admission.admit(key(patch), 100, desiredJobs(patch, 1), &batchv1.JobList{})).To(BeEmpty())
+
+		By("completing the running Job")
+		completed := first[0].DeepCopy()
+		completed.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(inventory, daemonv1beta1.GroupVersion.WithKind(kind))}
+		completed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: "True"}}
+		jobs := &batchv1.JobList{Items: []batchv1.Job{*completed}}
+
+		Expect(admission.admit(key(inventory), 0, desiredJobs(inventory, 1), jobs)).To(BeEmpty())
+		Expect(admission.admit(key(patch), 100, desiredJobs(patch, 1), jobs)).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,165 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	eventReasonAdoptedJob  = "AdoptedJob"
+	eventReasonJobConflict = "JobConflict"
+
+	reasonForeignJob = "ForeignJob"
+	reasonNoConflict = "NoConflict"
+)
+
+// adoptJobs adopts the orphan Jobs labeled with the name of the DaemonJob,
+// e.g. the Jobs orphaned by a previous DaemonJob of the same name, and adds
+// them to the child Jobs. Like the ControllerRefManager of the upstream
+// controllers, nothing is adopted once the DaemonJob is being deleted.
+func (r *DaemonJobReconciler) adoptJobs(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList) error {
+	log := clog.FromContext(ctx)
+
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs,
+		client.InNamespace(dj.Namespace),
+		client.MatchingLabels{daemonJobLabel: labelValue(dj.Name)}); err != nil {
+		return err
+	}
+
+	var orphans []*batchv1.Job
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if metav1.GetControllerOf(job) != nil || !job.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// the Jobs of a ClusterDaemonJob have no controller either
+		if _, ok := job.Labels[clusterDaemonJobLabel]; ok {
+			continue
+		}
+		orphans = append(orphans, job)
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	// The cache may not have seen the deletion of the DaemonJob yet
+	fresh := &daemonv1beta1.DaemonJob{}
+	if err := r.APIReader.Get(ctx, client.ObjectKeyFromObject(dj), fresh); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if fresh.UID != dj.UID || !fresh.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	for _, job := range orphans {
+		patch := client.MergeFromWithOptions(job.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		if err := ctrl.SetControllerReference(dj, job, r.Scheme); err != nil {
+			return err
+		}
+		child := job.Labels[daemonJobUIDLabel] == string(dj.UID)
+		job.Labels[daemonJobUIDLabel] = string(dj.UID)
+		if err := r.Patch(ctx, job, patch); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		log.Info("adopted Job", "job", job.Name)
+		r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonAdoptedJob, "Adopted Job %s", job.Name)
+		if !child {
+			childJobs.Items = append(childJobs.Items, *job)
+		}
+	}
+
+	return nil
+}
+
+// jobConflicts returns the desired Jobs whose name is free, or taken by a Job
+// selected by owns that is not a child Job yet. The nodes of the other Jobs
+// are held back, and the names of the foreign Jobs taking them are returned.
+func (r *DaemonJobReconciler) jobConflicts(ctx context.Context, desiredJobs []*batchv1.Job, holds map[string]string, owns func(job *batchv1.Job) bool) ([]*batchv1.Job, []string, error) {
+	freeJobs := make([]*batchv1.Job, 0, len(desiredJobs))
+	var conflicts []string
+
+	for _, job := range desiredJobs {
+		existing := &batchv1.Job{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(job), existing); err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, nil, err
+			}
+			freeJobs = append(freeJobs, job)
+			continue
+		}
+		if owns(existing) {
+			freeJobs = append(freeJobs, job)
+			continue
+		}
+
+		conflicts = append(conflicts, existing.Name)
+		holds[job.Annotations[annotation]] = fmt.Sprintf("foreign Job %s takes the name of the Job", existing.Name)
+	}
+
+	return freeJobs, conflicts, nil
+}
+
+// setConflictStatus records the foreign Jobs taking the names of the Jobs in
+// the JobConflict condition.
+func setConflictStatus(status *daemonv1beta1.DaemonJobStatus, conflicts []string) {
+	if len(conflicts) == 0 {
+		if meta.FindStatusCondition(status.Conditions, daemonv1beta1.DaemonJobJobConflict) != nil {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:    daemonv1beta1.DaemonJobJobConflict,
+				Status:  metav1.ConditionFalse,
+				Reason:  reasonNoConflict,
+				Message: "no foreign Job takes the name of a Job",
+			})
+		}
+		return
+	}
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:   daemonv1beta1.DaemonJobJobConflict,
+		Status: metav1.ConditionTrue,
+		Reason: reasonForeignJob,
+		Message: fmt.Sprintf("%d foreign Job(s) take the name of Jobs: %s",
+			len(conflicts), strings.Join(conflicts, ", ")),
+	})
+}
+
+// recordConflicts emits a Warning event on the object for every foreign Job.
+func (r *DaemonJobReconciler) recordConflicts(object runtime.Object, conflicts []string) {
+	for _, name := range conflicts {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, eventReasonJobConflict,
+			"Foreign Job %s takes the name of a Job, its node is held back", name)
+	}
+}
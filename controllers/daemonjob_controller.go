@@ -18,17 +18,21 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-
 	"reflect"
+	"sort"
+	"time"
 
 	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -37,28 +41,52 @@ import (
 )
 
 var (
-	jobOwnerKey = ".metadata.controller"
-	apiGVStr    = daemonv1alpha1.GroupVersion.String()
-	kind        = reflect.TypeOf(daemonv1alpha1.DaemonJob{}).Name()
-	annotation  = "daemon.justk8s.com/node-name"
+	daemonJobUIDKey        = ".metadata.labels.daemonjob-uid"
+	apiGroup               = daemonv1beta1.GroupVersion.Group
+	kind                   = reflect.TypeOf(daemonv1beta1.DaemonJob{}).Name()
+	annotation             = "daemon.justk8s.com/node-name"
+	templateHashAnnotation = "daemon.justk8s.com/template-hash"
+	stageAnnotation        = "daemon.justk8s.com/stage"
+	daemonJobLabel         = "daemon.justk8s.com/daemonjob"
+	daemonJobUIDLabel      = "daemon.justk8s.com/daemonjob-uid"
+	nodeNameLabel          = "daemon.justk8s.com/node-name"
+	templateHashLabel      = "daemon.justk8s.com/template-hash"
 )
 
 // DaemonJobReconciler reconciles a DaemonJob object
 type DaemonJobReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	// APIReader reads from the API server directly, bypassing the cache
+	APIReader client.Reader
+	Scheme    *runtime.Scheme
+	Recorder  record.EventRecorder
+
+	// MaxActiveJobs is the maximum number of active Jobs across all
+	// DaemonJobs, 0 means no limit.
+	MaxActiveJobs int
+	// NodeActions lets the DaemonJobs taint, label and annotate the nodes. The
+	// operator must be bound to the node ClusterRole.
+	NodeActions bool
+	admission   *jobAdmission
+	exclusion   *exclusionLocks
+	// kubeClient evicts the pods of the drained nodes
+	kubeClient kubernetes.Interface
 }
 
 //+kubebuilder:rbac:groups=daemon.justk8s.com,resources=daemonjobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=daemon.justk8s.com,resources=daemonjobs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=daemon.justk8s.com,resources=daemonjobs/finalizers,verbs=update
 
+//+kubebuilder:rbac:groups=daemon.justk8s.com,resources=nodereports,verbs=get;list;watch;create;update;patch;delete
+
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=batch,resources=jobs/finalizers,verbs=update
 
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=nodes/status,verbs=get
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -68,9 +96,12 @@ func (r *DaemonJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	log.Info("reconciling DaemonJob")
 
 	// Retrieve DaemonJob object
-	var daemonJob daemonv1alpha1.DaemonJob
+	var daemonJob daemonv1beta1.DaemonJob
 	if err := r.Get(ctx, req.NamespacedName, &daemonJob); err != nil {
 		log.Error(err, "unable to fetch DaemonJob")
+		if errors.IsNotFound(err) {
+			r.admission.forget(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
@@ -78,11 +109,17 @@ func (r *DaemonJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	var childJobs batchv1.JobList
 	if err := r.List(ctx, &childJobs,
 		client.InNamespace(req.Namespace),
-		client.MatchingFields{jobOwnerKey: req.Name}); err != nil {
+		client.MatchingFields{daemonJobUIDKey: string(daemonJob.UID)}); err != nil {
 		log.Error(err, "unable to list child Jobs")
 		return ctrl.Result{}, err
 	}
 
+	// Adopt the orphan Jobs labeled with the DaemonJob name
+	if err := r.adoptJobs(ctx, &daemonJob, &childJobs); err != nil {
+		log.Error(err, "unable to adopt orphan Jobs")
+		return ctrl.Result{}, err
+	}
+
 	// Get List of all nodes
 	nodeList, err := r.listNodes(ctx)
 	if err != nil {
@@ -90,8 +127,133 @@ func (r *DaemonJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	// Tear down the nodes and release the Jobs before letting a deleted DaemonJob go
+	if !daemonJob.DeletionTimestamp.IsZero() {
+		return r.finalizeDaemonJob(ctx, &daemonJob, &childJobs, nodeList)
+	}
+
+	if updated, err := r.reconcileFinalizer(ctx, &daemonJob); err != nil || updated {
+		return ctrl.Result{}, err
+	}
+
+	// Replace the Jobs of the nodes selected by a pending rerun
+	rerunToken, err := r.rerunJobs(ctx, &daemonJob, &childJobs)
+	if err != nil {
+		log.Error(err, "unable to rerun DaemonJob")
+		return ctrl.Result{}, err
+	}
+
+	// Recreate the OOMKilled Jobs with more memory
+	if err := r.bumpOOMKilledNodes(ctx, &daemonJob, &childJobs); err != nil {
+		log.Error(err, "unable to scale up the memory of OOMKilled nodes")
+		return ctrl.Result{}, err
+	}
+
+	// Recreate the failed Jobs whose retry delay elapsed
+	holds := make(map[string]string)
+	retryDelay, err := r.retryFailedNodes(ctx, &daemonJob, &childJobs, holds)
+	if err != nil {
+		log.Error(err, "unable to retry failed nodes")
+		return ctrl.Result{}, err
+	}
+
+	// Group childJobs by node
+	jobs := jobsByNode(&childJobs)
+
+	// Hold back the nodes waiting for their dependencies
+	if err := r.dependencyHolds(ctx, &daemonJob, nodeList, jobs, holds); err != nil {
+		log.Error(err, "unable to check DaemonJob dependencies")
+		return ctrl.Result{}, err
+	}
+
+	// Hold back the nodes where another DaemonJob of the exclusion group is
+	// running, the group being locked until the Jobs are created
+	unlock := r.exclusion.lock(daemonJob.Spec.ExclusionGroup)
+	defer unlock()
+	locked := make(map[string]string)
+	excluded, err := r.exclusionHolds(ctx, &daemonJob, locked)
+	if err != nil {
+		log.Error(err, "unable to check DaemonJob exclusion group")
+		return ctrl.Result{}, err
+	}
+	for nodeName, reason := range locked {
+		if _, held := holds[nodeName]; !held {
+			holds[nodeName] = reason
+		}
+	}
+
+	// Hold back or skip the nodes that are NotReady, unschedulable or scaled down
+	r.nodeConditionHolds(&daemonJob, nodeList, jobs, holds)
+
+	// Cordon and drain the nodes about to get a Job
+	draining, err := r.maintenanceHolds(ctx, &daemonJob, nodeList, jobs, holds)
+	if err != nil {
+		log.Error(err, "unable to cordon and drain nodes")
+		return ctrl.Result{}, err
+	}
+
+	// write NodeReports
+	var reports []daemonv1alpha1.NodeReport
+	if collectsOutput(&daemonJob) {
+		reports, err = r.reconcileNodeReports(ctx, &daemonJob, &childJobs, nodeList)
+		if err != nil {
+			log.Error(err, "unable to write NodeReports")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// desiredJobs
+	desiredJobs := r.desiredJobsForDaemonJob(req.Namespace, &daemonJob, nodeList, jobs, holds)
+
+	// hold back the nodes whose Job name is taken by a foreign Job
+	desiredJobs, conflicts, err := r.jobConflicts(ctx, desiredJobs, holds, func(job *batchv1.Job) bool {
+		owner := metav1.GetControllerOf(job)
+		return owner != nil && owner.UID == daemonJob.UID
+	})
+	if err != nil {
+		log.Error(err, "unable to check desired jobs conflicts")
+		return ctrl.Result{}, err
+	}
+	r.recordConflicts(&daemonJob, conflicts)
+
+	// admit the desired Jobs within the operator-wide limit
+	admittedJobs, err := r.admitJobs(ctx, req.NamespacedName, daemonJob.Spec.Priority, desiredJobs, holds)
+	if err != nil {
+		log.Error(err, "unable to admit desired jobs")
+		return ctrl.Result{}, err
+	}
+
 	// update status
-	status := r.daemonJobStatus(&daemonJob, &childJobs, nodeList)
+	status := r.daemonJobStatus(&daemonJob, jobs, holds, nodeList)
+	setDriftStatus(&daemonJob, status, reports)
+	setConflictStatus(status, conflicts)
+	status.RerunToken = rerunToken
+
+	// quarantine the failed nodes
+	if err := r.reconcileQuarantine(ctx, &daemonJob, status, nodeList); err != nil {
+		log.Error(err, "unable to quarantine failed nodes")
+		return ctrl.Result{}, err
+	}
+
+	// label and annotate the succeeded nodes
+	if err := r.reconcileNodeMarks(ctx, &daemonJob, status, nodeList); err != nil {
+		log.Error(err, "unable to mark succeeded nodes")
+		return ctrl.Result{}, err
+	}
+
+	// reboot the nodes whose job requested it
+	rebootDelay, err := r.reconcileReboots(ctx, &daemonJob, status, nodeList, jobs, locked)
+	if err != nil {
+		log.Error(err, "unable to reboot nodes")
+		return ctrl.Result{}, err
+	}
+
+	// uncordon the succeeded nodes
+	if err := r.reconcileMaintenance(ctx, &daemonJob, status, nodeList); err != nil {
+		log.Error(err, "unable to uncordon succeeded nodes")
+		return ctrl.Result{}, err
+	}
+
 	if !reflect.DeepEqual(status, daemonJob.Status) {
 		log.Info("Updating daemon job status")
 		daemonJob.Status = *status.DeepCopy()
@@ -101,17 +263,49 @@ func (r *DaemonJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
-	// desiredJobs
-	desiredJobs := r.desiredJobsForDaemonJob(req.Namespace, &daemonJob, nodeList)
-
 	// create desired Jobs
-	err = r.createDesiredJobsForDaemonJob(ctx, &daemonJob, desiredJobs)
+	err = r.createDesiredJobsForDaemonJob(ctx, &daemonJob, admittedJobs)
 	if err != nil {
 		log.Error(err, "error creating desired jobs")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	var result ctrl.Result
+
+	// Check again later the nodes locked by the exclusion group
+	if excluded {
+		requeueAfter(&result, exclusionRequeueDelay)
+	}
+
+	// Ask again later for the slots of the Jobs not admitted
+	if len(admittedJobs) < len(desiredJobs) {
+		requeueAfter(&result, admissionRequeueDelay)
+	}
+
+	// Check again later the pods of the draining nodes
+	if draining {
+		requeueAfter(&result, drainRequeueDelay)
+	}
+
+	// Check again later the rebooting nodes
+	if rebootDelay > 0 {
+		requeueAfter(&result, rebootDelay)
+	}
+
+	// Retry the failed nodes once their delay elapsed
+	if retryDelay > 0 {
+		requeueAfter(&result, retryDelay)
+	}
+
+	return result, nil
+}
+
+// requeueAfter sets the result to requeue after the delay, unless it already
+// requeues sooner.
+func requeueAfter(result *ctrl.Result, delay time.Duration) {
+	if result.RequeueAfter == 0 || delay < result.RequeueAfter {
+		result.RequeueAfter = delay
+	}
 }
 
 func (r *DaemonJobReconciler) listNodes(ctx context.Context) (*v1.NodeList, error) {
@@ -126,37 +320,69 @@ func (r *DaemonJobReconciler) listNodes(ctx context.Context) (*v1.NodeList, erro
 }
 
 //nolint
-func (r *DaemonJobReconciler) daemonJobStatus(dj *daemonv1alpha1.DaemonJob, childJobs *batchv1.JobList, nodeList *v1.NodeList) *daemonv1alpha1.DaemonJobStatus {
+func (r *DaemonJobReconciler) daemonJobStatus(dj *daemonv1beta1.DaemonJob, jobs map[string]nodeJobs, holds map[string]string, nodeList *v1.NodeList) *daemonv1beta1.DaemonJobStatus {
 	var desiredNumberScheduled, numberAvailable, completedJobs, failedJobs int32
 
+	// the retries, memory bumps, quarantines, marks and reboots of the nodes are only kept in the status
+	previous := make(map[string]daemonv1beta1.NodeStatus, len(dj.Status.Nodes))
+	for _, nodeStatus := range dj.Status.Nodes {
+		previous[nodeStatus.NodeName] = nodeStatus
+	}
+
 	// desiredNumberScheduled = len(nodeList.Items)
+	nodes := make([]daemonv1beta1.NodeStatus, 0, len(nodeList.Items))
 	for _, node := range nodeList.Items {
 		shouldRun, _ := r.nodeShouldRunDaemonJob(&node, dj)
+		skipped := shouldRun && skipsNode(dj, &node, jobs[node.Name])
 
-		if shouldRun {
+		if shouldRun && !skipped {
 			desiredNumberScheduled++
+		} else if _, ok := jobs[node.Name]; !ok && !skipped {
+			continue
 		}
-	}
 
-	for _, job := range childJobs.Items {
-		finishedType := jobStatus(job)
-		switch finishedType {
-		case "": // ongoing
+		nodeStatus, next := nodeProgress(dj, node.Name, jobs[node.Name])
+		if next != nil || nodeStatus.Phase == daemonv1beta1.NodeFailed {
+			nodeStatus.Reason = holds[node.Name]
+		}
+		if skipped {
+			condition, _ := nodeCondition(dj, &node)
+			nodeStatus.Phase = daemonv1beta1.NodeSkipped
+			nodeStatus.Reason = skippedReason(condition)
+		}
+		nodeStatus.Retries = previous[node.Name].Retries
+		nodeStatus.MemoryBumps = previous[node.Name].MemoryBumps
+		nodeStatus.Quarantined = hasNodeOwner(&node, quarantineAnnotation, nodeOwner(dj))
+		nodeStatus.Marked = hasNodeOwner(&node, marksAnnotation, nodeOwner(dj))
+		nodeStatus.Reboot = previous[node.Name].Reboot
+		nodes = append(nodes, nodeStatus)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].NodeName < nodes[j].NodeName
+	})
+
+	// the jobs of a node are counted once, by the phase of the node
+	for nodeName, nodeJobs := range jobs {
+		nodeStatus, _ := nodeProgress(dj, nodeName, nodeJobs)
+		switch nodeStatus.Phase {
+		case daemonv1beta1.NodeRunning:
 			numberAvailable++
-		case batchv1.JobFailed:
+		case daemonv1beta1.NodeFailed:
 			failedJobs++
 			numberAvailable++
-		case batchv1.JobComplete:
+		case daemonv1beta1.NodeSucceeded:
 			completedJobs++
 			numberAvailable++
 		}
 	}
 
-	status := &daemonv1alpha1.DaemonJobStatus{
+	status := &daemonv1beta1.DaemonJobStatus{
 		DesiredNumberScheduled: desiredNumberScheduled,
 		NumberAvailable:        &numberAvailable,
 		FailedJobs:             &failedJobs,
 		CompletedJobs:          &completedJobs,
+		Nodes:                  nodes,
+		Conditions:             dj.Status.DeepCopy().Conditions,
 	}
 
 	return status
@@ -171,7 +397,7 @@ func (r *DaemonJobReconciler) daemonJobStatus(dj *daemonv1alpha1.DaemonJob, chil
 // * shouldContinueRunning:
 //     Returns true when a daemonset should continue running on a node if a daemonset pod is already
 //     running on that node.
-func (r *DaemonJobReconciler) nodeShouldRunDaemonJob(node *v1.Node, dj *daemonv1alpha1.DaemonJob) (bool, bool) {
+func (r *DaemonJobReconciler) nodeShouldRunDaemonJob(node *v1.Node, dj *daemonv1beta1.DaemonJob) (bool, bool) {
 	// pod := daemonctrl.NewPod(dj, node.Name)
 
 	// If the daemon job specifies a node name, check that it matches with node.Name.
@@ -179,48 +405,104 @@ func (r *DaemonJobReconciler) nodeShouldRunDaemonJob(node *v1.Node, dj *daemonv1
 		return false, false
 	}
 
+	// If the daemon job specifies a node selector, check that the node labels match it.
+	if dj.Spec.NodeSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(dj.Spec.NodeSelector)
+		if err != nil || !selector.Matches(labels.Set(node.Labels)) {
+			return false, false
+		}
+	}
+
 	return true, true
 }
 
-// Create required Jobs that should be running
-func (r *DaemonJobReconciler) desiredJobsForDaemonJob(namespace string, daemonJob *daemonv1alpha1.DaemonJob, nodeList *v1.NodeList) []*batchv1.Job {
-	jobTemplate := &daemonJob.Spec.JobTemplate
-
-	jobs := make([]*batchv1.Job, 0, len(nodeList.Items))
+// Create required Jobs that should be running.
+// The nodes held back are skipped, they get their Jobs on a later reconcile.
+func (r *DaemonJobReconciler) desiredJobsForDaemonJob(namespace string, daemonJob *daemonv1beta1.DaemonJob, nodeList *v1.NodeList, jobs map[string]nodeJobs, holds map[string]string) []*batchv1.Job {
+	desiredJobs := make([]*batchv1.Job, 0, len(nodeList.Items))
 
 	for _, node := range nodeList.Items {
-		jobName := fmt.Sprintf("%s-%s", daemonJob.Name, node.Name)
-
-		job := &batchv1.Job{
-			ObjectMeta: metav1.ObjectMeta{
-				Labels:      make(map[string]string),
-				Annotations: make(map[string]string),
-				Name:        jobName,
-				Namespace:   namespace,
-			},
-			Spec: *jobTemplate.Spec.DeepCopy(),
-		}
-		for k, v := range jobTemplate.Annotations {
-			job.Annotations[k] = v
+		if shouldRun, _ := r.nodeShouldRunDaemonJob(&node, daemonJob); !shouldRun {
+			continue
 		}
-		// Add nodeName annotation
-		job.Annotations[annotation] = node.Name
 
-		for k, v := range jobTemplate.Labels {
-			job.Labels[k] = v
+		_, stage := nodeProgress(daemonJob, node.Name, jobs[node.Name])
+		if stage == nil {
+			continue
 		}
-		if len(job.Spec.Template.Spec.NodeSelector) == 0 {
-			job.Spec.Template.Spec.NodeSelector = make(map[string]string)
+		if _, held := holds[node.Name]; held {
+			continue
 		}
-		job.Spec.Template.Spec.NodeSelector["kubernetes.io/hostname"] = node.Name
 
-		jobs = append(jobs, job)
+		desiredJobs = append(desiredJobs, newJob(namespace, daemonJob, node.Name, *stage))
 	}
-	return jobs
+	return desiredJobs
+}
+
+// newJob returns the Job of the given stage on a node
+func newJob(namespace string, daemonJob *daemonv1beta1.DaemonJob, nodeName, stage string) *batchv1.Job {
+	jobTemplate := stageTemplate(daemonJob, stage)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      make(map[string]string),
+			Annotations: make(map[string]string),
+			Name:        jobName(daemonJob.Name, nodeName, stage),
+			Namespace:   namespace,
+		},
+		Spec: *jobTemplate.Spec.DeepCopy(),
+	}
+	// a failed check means the node needs the fix, not another check
+	if (stage == checkStage || stage == verifyStage) && job.Spec.BackoffLimit == nil {
+		backoffLimit := int32(0)
+		job.Spec.BackoffLimit = &backoffLimit
+	}
+	for k, v := range jobTemplate.Annotations {
+		job.Annotations[k] = v
+	}
+	// Add nodeName, stage and template hash annotations
+	job.Annotations[annotation] = nodeName
+	job.Annotations[templateHashAnnotation] = templateHash(jobTemplate)
+	if stage != mainStage {
+		job.Annotations[stageAnnotation] = stage
+	}
+
+	for k, v := range jobTemplate.Labels {
+		job.Labels[k] = v
+	}
+	// Add the labels selecting the Jobs and their pods
+	if job.Spec.Template.Labels == nil {
+		job.Spec.Template.Labels = make(map[string]string)
+	}
+	for k, v := range jobLabels(daemonJob, nodeName, job.Annotations[templateHashAnnotation]) {
+		job.Labels[k] = v
+		job.Spec.Template.Labels[k] = v
+	}
+	if len(job.Spec.Template.Spec.NodeSelector) == 0 {
+		job.Spec.Template.Spec.NodeSelector = make(map[string]string)
+	}
+	job.Spec.Template.Spec.NodeSelector["kubernetes.io/hostname"] = nodeName
+
+	// Keep the memory scaled up by the OOM kills on the node
+	if daemonJob.Spec.OOMRetry != nil && scalesMemory(stage) {
+		scaleMemory(&job.Spec.Template.Spec, daemonJob.Spec.OOMRetry, memoryBumps(daemonJob, nodeName))
+	}
+
+	// Run on the nodes cordoned for their maintenance
+	if maintainsNodes(daemonJob) {
+		tolerateUnschedulable(&job.Spec.Template.Spec)
+	}
+
+	// Run on the nodes quarantined after a failure
+	if action := quarantineAction(daemonJob); action != nil && action.Taint != nil {
+		tolerateTaint(&job.Spec.Template.Spec, action.Taint)
+	}
+
+	return job
 }
 
 // Create Desired Jobs
-func (r *DaemonJobReconciler) createDesiredJobsForDaemonJob(ctx context.Context, daemonJob *daemonv1alpha1.DaemonJob, desiredJobs []*batchv1.Job) error {
+func (r *DaemonJobReconciler) createDesiredJobsForDaemonJob(ctx context.Context, daemonJob *daemonv1beta1.DaemonJob, desiredJobs []*batchv1.Job) error {
 	log := clog.FromContext(ctx)
 
 	for _, job := range desiredJobs {
@@ -241,7 +523,7 @@ func (r *DaemonJobReconciler) createDesiredJobsForDaemonJob(ctx context.Context,
 func (r *DaemonJobReconciler) mapToDaemonJob(_ client.Object) []ctrl.Request {
 	ctx := context.Background()
 	log := clog.FromContext(ctx)
-	daemonJobList := &daemonv1alpha1.DaemonJobList{}
+	daemonJobList := &daemonv1beta1.DaemonJobList{}
 	err := r.Client.List(ctx, daemonJobList)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
@@ -262,28 +544,66 @@ func (r *DaemonJobReconciler) mapToDaemonJob(_ client.Object) []ctrl.Request {
 	return results
 }
 
-func (r *DaemonJobReconciler) indexJobOwnerField(rawObj client.Object) []string {
+// indexJobDaemonJobUIDField indexes the Jobs by the UID of their DaemonJob,
+// from their label or, for the Jobs created before the labels, their owner.
+func (r *DaemonJobReconciler) indexJobDaemonJobUIDField(rawObj client.Object) []string {
 	job := rawObj.(*batchv1.Job)
+	if uid, ok := job.Labels[daemonJobUIDLabel]; ok {
+		return []string{uid}
+	}
 	owner := metav1.GetControllerOf(job)
-	if owner == nil {
+	if !isDaemonJobOwner(owner) {
 		return nil
 	}
-	if owner.APIVersion != apiGVStr || owner.Kind != kind {
-		return nil
+	return []string{string(owner.UID)}
+}
+
+// isDaemonJobOwner returns whether the owner reference is a DaemonJob, of any
+// version: Jobs created before an upgrade still reference an older version.
+func isDaemonJobOwner(owner *metav1.OwnerReference) bool {
+	if owner == nil || owner.Kind != kind {
+		return false
 	}
-	return []string{owner.Name}
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	return err == nil && gv.Group == apiGroup
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DaemonJobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.admission = newJobAdmission(r.MaxActiveJobs)
+	r.exclusion = newExclusionLocks()
+
+	kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	r.kubeClient = kubeClient
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &batchv1.Job{}, daemonJobUIDKey, r.indexJobDaemonJobUIDField); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1.Pod{}, podNodeNameKey, indexPodNodeNameField); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &daemonv1beta1.DaemonJob{}, dependsOnKey, indexDependsOnField); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &daemonv1beta1.DaemonJob{}, exclusionGroupKey, indexExclusionGroupField); err != nil {
+		return err
+	}
 
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &batchv1.Job{}, jobOwnerKey, r.indexJobOwnerField); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &daemonv1alpha1.ClusterDaemonJob{}, exclusionGroupKey, indexClusterExclusionGroupField); err != nil {
 		return err
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&daemonv1alpha1.DaemonJob{}).
+		For(&daemonv1beta1.DaemonJob{}).
 		Watches(&source.Kind{Type: &v1.Node{}}, handler.EnqueueRequestsFromMapFunc(r.mapToDaemonJob)).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(r.mapToDependentDaemonJobs)).
 		Owns(&batchv1.Job{}).
+		Owns(&daemonv1alpha1.NodeReport{}).
 		Complete(r)
 }
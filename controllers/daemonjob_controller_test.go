@@ -25,11 +25,15 @@ import (
 
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -49,25 +53,25 @@ var _ = Describe("DaemonJob controller", func() {
 		ctx := context.Background()
 
 		daemonJobLookupKey := types.NamespacedName{Name: DaemonJobName, Namespace: Namespace}
-		createdDaemonJob := &daemonv1alpha1.DaemonJob{}
+		createdDaemonJob := &daemonv1beta1.DaemonJob{}
 		jobLookupKey := types.NamespacedName{Name: JobName, Namespace: Namespace}
 		createdJob := &batchv1.Job{}
-		gvk := daemonv1alpha1.GroupVersion.WithKind(kind)
+		gvk := daemonv1beta1.GroupVersion.WithKind(kind)
 
 		It("should increase DaemonJob Status.NumberAvailable when new Jobs are created", func() {
 			By("creating a new DaemonJob")
 
-			daemonJob := &daemonv1alpha1.DaemonJob{
+			daemonJob := &daemonv1beta1.DaemonJob{
 				TypeMeta: metav1.TypeMeta{
-					APIVersion: "daemon.justk8s.com/v1alpha1",
+					APIVersion: "daemon.justk8s.com/v1beta1",
 					Kind:       "DaemonJob",
 				},
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      DaemonJobName,
 					Namespace: Namespace,
 				},
-				Spec: daemonv1alpha1.DaemonJobSpec{
-					JobTemplate: daemonv1alpha1.JobTemplateSpec{
+				Spec: daemonv1beta1.DaemonJobSpec{
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
 						Spec: batchv1.JobSpec{
 							Template: v1.PodTemplateSpec{
 								Spec: v1.PodSpec{
@@ -173,7 +177,7 @@ var _ = Describe("DaemonJob controller", func() {
 
 			By("checking the DaemonJob has zero child Jobs")
 			Eventually(func() (int, error) {
-				emptyDaemonJobSet := &daemonv1alpha1.DaemonJob{}
+				emptyDaemonJobSet := &daemonv1beta1.DaemonJob{}
 				err := k8sClient.Get(ctx, daemonJobLookupKey, emptyDaemonJobSet)
 				if err != nil {
 					return -1, err
@@ -212,4 +216,1613 @@ var _ = Describe("DaemonJob controller", func() {
 		})
 
 	})
+
+	Context("When collecting NodeReports", func() {
+		ctx := context.Background()
+
+		const ReportDaemonJobName = "report-daemonjob"
+
+		It("should write a NodeReport with the output of a completed Job", func() {
+			By("creating a new DaemonJob with reports")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ReportDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					Report: &daemonv1beta1.ReportSpec{},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:    "test",
+											Image:   "busybox",
+											Command: []string{"uname", "-r"},
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("checking that Job has been created")
+			job := &batchv1.Job{}
+			jobLookupKey := types.NamespacedName{Name: ReportDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Expect(job.Annotations[templateHashAnnotation]).To(Equal(templateHash(&daemonJob.Spec.JobTemplate)))
+
+			By("checking the labels of the Job and its pods")
+			for _, labels := range []map[string]string{job.Labels, job.Spec.Template.Labels} {
+				Expect(labels).To(HaveKeyWithValue(daemonJobLabel, ReportDaemonJobName))
+				Expect(labels).To(HaveKeyWithValue(daemonJobUIDLabel, string(daemonJob.UID)))
+				Expect(labels).To(HaveKeyWithValue(nodeNameLabel, NodeName))
+				Expect(labels).To(HaveKeyWithValue(templateHashLabel, templateHash(&daemonJob.Spec.JobTemplate)))
+			}
+
+			By("completing the pod of the Job")
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      jobLookupKey.Name,
+					Namespace: Namespace,
+					Labels:    map[string]string{"controller-uid": string(job.UID)},
+				},
+				Spec: *job.Spec.Template.Spec.DeepCopy(),
+			}
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+			pod.Status = v1.PodStatus{
+				Phase: v1.PodSucceeded,
+				ContainerStatuses: []v1.ContainerStatus{
+					{
+						Name: "test",
+						State: v1.ContainerState{
+							Terminated: &v1.ContainerStateTerminated{Message: `{"kernel":"5.10.0"}`},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+			By("completing the Job")
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			job.Status.CompletionTime = &now
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the NodeReport has been written")
+			report := &daemonv1alpha1.NodeReport{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: reportName(ReportDaemonJobName, NodeName), Namespace: Namespace}, report)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Expect(report.Labels[daemonJobLabel]).To(Equal(ReportDaemonJobName))
+			Expect(report.Spec.NodeName).To(Equal(NodeName))
+			Expect(report.Spec.JobName).To(Equal(job.Name))
+			Expect(report.Spec.Output).ToNot(BeNil())
+			Expect(report.Spec.Output.Raw).To(MatchJSON(`{"kernel":"5.10.0"}`))
+		})
+	})
+	Context("When a DaemonJob depends on another DaemonJob", func() {
+		ctx := context.Background()
+
+		const (
+			InstallDaemonJobName   = "install-daemonjob"
+			ConfigureDaemonJobName = "configure-daemonjob"
+		)
+
+		jobTemplate := daemonv1beta1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{
+							{
+								Name:  "test",
+								Image: "busybox",
+							},
+						},
+						RestartPolicy: v1.RestartPolicyOnFailure,
+					},
+				},
+			},
+		}
+
+		It("should only create the Job of a node once the dependency succeeded on it", func() {
+			By("creating the dependent DaemonJob")
+			configure := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ConfigureDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					DependsOn:   []daemonv1beta1.DaemonJobReference{{Name: InstallDaemonJobName}},
+					JobTemplate: jobTemplate,
+				},
+			}
+			Expect(k8sClient.Create(ctx, configure)).Should(Succeed())
+
+			By("checking that the node is held back")
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(configure), configure); err != nil {
+					return ""
+				}
+				for _, node := range configure.Status.Nodes {
+					if node.NodeName == NodeName {
+						return node.Reason
+					}
+				}
+				return ""
+			}, timeout, interval).Should(ContainSubstring(InstallDaemonJobName))
+			configureJobKey := types.NamespacedName{Name: ConfigureDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Consistently(func() error {
+				return k8sClient.Get(ctx, configureJobKey, &batchv1.Job{})
+			}, time.Second, interval).Should(HaveOccurred())
+
+			By("creating the DaemonJob it depends on")
+			install := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      InstallDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					JobTemplate: jobTemplate,
+				},
+			}
+			Expect(k8sClient.Create(ctx, install)).Should(Succeed())
+
+			installJob := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: InstallDaemonJobName + "-" + NodeName, Namespace: Namespace}, installJob)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+
+			By("completing the Job of the dependency")
+			now := metav1.Now()
+			installJob.Status.StartTime = &now
+			installJob.Status.CompletionTime = &now
+			installJob.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, installJob)).Should(Succeed())
+
+			By("checking that the Job of the dependent DaemonJob has been created")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, configureJobKey, &batchv1.Job{})
+			}, timeout, interval).ShouldNot(HaveOccurred())
+		})
+	})
+	Context("When DaemonJobs share an exclusion group", func() {
+		ctx := context.Background()
+
+		const (
+			ExclusionGroup      = "containerd"
+			OtherNamespace      = "exclusion"
+			FirstDaemonJobName  = "restart-containerd"
+			SecondDaemonJobName = "upgrade-containerd"
+		)
+
+		jobTemplate := daemonv1beta1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{
+							{
+								Name:  "test",
+								Image: "busybox",
+							},
+						},
+						RestartPolicy: v1.RestartPolicyOnFailure,
+					},
+				},
+			},
+		}
+
+		It("should not run their Jobs on the same node at the same time", func() {
+			By("creating a DaemonJob of the group")
+			first := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      FirstDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					ExclusionGroup: ExclusionGroup,
+					JobTemplate:    jobTemplate,
+				},
+			}
+			Expect(k8sClient.Create(ctx, first)).Should(Succeed())
+
+			firstJob := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: FirstDaemonJobName + "-" + NodeName, Namespace: Namespace}, firstJob)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+
+			By("creating another DaemonJob of the group in another namespace")
+			Expect(k8sClient.Create(ctx, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: OtherNamespace}})).Should(Succeed())
+			second := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      SecondDaemonJobName,
+					Namespace: OtherNamespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					ExclusionGroup: ExclusionGroup,
+					JobTemplate:    jobTemplate,
+				},
+			}
+			Expect(k8sClient.Create(ctx, second)).Should(Succeed())
+
+			By("checking that the node is locked by the running Job")
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(second), second); err != nil {
+					return ""
+				}
+				for _, node := range second.Status.Nodes {
+					if node.NodeName == NodeName {
+						return node.Reason
+					}
+				}
+				return ""
+			}, timeout, interval).Should(ContainSubstring(FirstDaemonJobName))
+			secondJobKey := types.NamespacedName{Name: SecondDaemonJobName + "-" + NodeName, Namespace: OtherNamespace}
+			Expect(k8sClient.Get(ctx, secondJobKey, &batchv1.Job{})).ShouldNot(Succeed())
+
+			By("completing the running Job")
+			now := metav1.Now()
+			firstJob.Status.StartTime = &now
+			firstJob.Status.CompletionTime = &now
+			firstJob.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, firstJob)).Should(Succeed())
+
+			By("checking that the Job of the other DaemonJob has been created")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, secondJobKey, &batchv1.Job{})
+			}, timeout+exclusionRequeueDelay, interval).ShouldNot(HaveOccurred())
+		})
+	})
+	Context("When creating a ClusterDaemonJob", func() {
+		ctx := context.Background()
+
+		const ClusterDaemonJobName = "test-clusterdaemonjob"
+
+		It("should create labeled Jobs in the target namespace and delete them on deletion", func() {
+			By("creating a new ClusterDaemonJob")
+			clusterDaemonJob := &daemonv1alpha1.ClusterDaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ClusterDaemonJobName,
+				},
+				Spec: daemonv1alpha1.ClusterDaemonJobSpec{
+					TargetNamespace: Namespace,
+					JobTemplate: daemonv1alpha1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, clusterDaemonJob)).Should(Succeed())
+
+			By("checking that the Job has been created without controller")
+			job := &batchv1.Job{}
+			jobLookupKey := types.NamespacedName{Name: ClusterDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Expect(metav1.GetControllerOf(job)).To(BeNil())
+			Expect(job.Labels[clusterDaemonJobLabel]).To(Equal(ClusterDaemonJobName))
+			Expect(job.Annotations[annotation]).To(Equal(NodeName))
+
+			By("checking the finalizer and the status")
+			Eventually(func() []daemonv1alpha1.NodeStatus {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterDaemonJob), clusterDaemonJob); err != nil {
+					return nil
+				}
+				return clusterDaemonJob.Status.Nodes
+			}, timeout, interval).ShouldNot(BeEmpty())
+			Expect(clusterDaemonJob.Finalizers).To(ContainElement(clusterDaemonJobFinalizer))
+
+			By("deleting the ClusterDaemonJob")
+			Expect(k8sClient.Delete(ctx, clusterDaemonJob)).Should(Succeed())
+
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, jobLookupKey, &batchv1.Job{}))
+			}, timeout, interval).Should(BeTrue())
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterDaemonJob), clusterDaemonJob))
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("should wait for a missing target namespace", func() {
+			By("creating a ClusterDaemonJob targeting a missing namespace")
+			clusterDaemonJob := &daemonv1alpha1.ClusterDaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ClusterDaemonJobName + "-missing",
+				},
+				Spec: daemonv1alpha1.ClusterDaemonJobSpec{
+					TargetNamespace: "missing",
+					JobTemplate: daemonv1alpha1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, clusterDaemonJob)).Should(Succeed())
+
+			By("checking that the missing namespace is reported")
+			Eventually(func() []string {
+				var events v1.EventList
+				if err := k8sClient.List(ctx, &events, client.MatchingFields{"involvedObject.name": clusterDaemonJob.Name}); err != nil {
+					return nil
+				}
+				var reasons []string
+				for _, event := range events.Items {
+					reasons = append(reasons, event.Reason)
+				}
+				return reasons
+			}, timeout, interval).Should(ContainElement(eventReasonTargetNamespaceNotFound))
+
+			By("deleting the ClusterDaemonJob")
+			Expect(k8sClient.Delete(ctx, clusterDaemonJob)).Should(Succeed())
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterDaemonJob), clusterDaemonJob))
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+	Context("When a DaemonJob has a nodeSelector", func() {
+		ctx := context.Background()
+
+		const SelectorDaemonJobName = "selector-daemonjob"
+
+		It("should only create the Jobs of the selected nodes", func() {
+			By("creating a DaemonJob selecting no node")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      SelectorDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					NodeSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"kubernetes.io/os": "windows"},
+					},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			Eventually(func() *int32 {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return nil
+				}
+				return daemonJob.Status.NumberAvailable
+			}, timeout, interval).ShouldNot(BeNil())
+			Expect(daemonJob.Status.DesiredNumberScheduled).To(BeZero())
+			Expect(daemonJob.Status.Nodes).To(BeEmpty())
+
+			jobLookupKey := types.NamespacedName{Name: SelectorDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Consistently(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, &batchv1.Job{})
+			}, time.Second, interval).Should(HaveOccurred())
+
+			By("selecting the node")
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return err
+				}
+				daemonJob.Spec.NodeSelector = &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "kubernetes.io/os", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"windows"}},
+					},
+				}
+				return k8sClient.Update(ctx, daemonJob)
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, &batchv1.Job{})
+			}, timeout, interval).ShouldNot(HaveOccurred())
+		})
+	})
+	Context("When Jobs with the names of the DaemonJob Jobs exist", func() {
+		ctx := context.Background()
+
+		const (
+			AdoptDaemonJobName    = "adopt-daemonjob"
+			ConflictDaemonJobName = "conflict-daemonjob"
+		)
+
+		podTemplate := v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:  "test",
+						Image: "busybox",
+					},
+				},
+				RestartPolicy: v1.RestartPolicyOnFailure,
+			},
+		}
+		newDaemonJob := func(name string) *daemonv1beta1.DaemonJob {
+			return &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{Template: podTemplate},
+					},
+				},
+			}
+		}
+
+		It("should adopt the orphan Jobs labeled with the DaemonJob name", func() {
+			By("creating an orphan Job")
+			orphan := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        AdoptDaemonJobName + "-" + NodeName,
+					Namespace:   Namespace,
+					Labels:      map[string]string{daemonJobLabel: AdoptDaemonJobName},
+					Annotations: map[string]string{annotation: NodeName},
+				},
+				Spec: batchv1.JobSpec{Template: podTemplate},
+			}
+			Expect(k8sClient.Create(ctx, orphan)).Should(Succeed())
+
+			By("creating the DaemonJob")
+			daemonJob := newDaemonJob(AdoptDaemonJobName)
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("checking that the Job has been adopted")
+			Eventually(func() types.UID {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(orphan), orphan); err != nil {
+					return ""
+				}
+				if owner := metav1.GetControllerOf(orphan); owner != nil {
+					return owner.UID
+				}
+				return ""
+			}, timeout, interval).Should(Equal(daemonJob.UID))
+			Expect(orphan.Labels).To(HaveKeyWithValue(daemonJobUIDLabel, string(daemonJob.UID)))
+		})
+
+		It("should report the foreign Jobs", func() {
+			By("creating a foreign Job")
+			foreign := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ConflictDaemonJobName + "-" + NodeName,
+					Namespace: Namespace,
+				},
+				Spec: batchv1.JobSpec{Template: podTemplate},
+			}
+			Expect(k8sClient.Create(ctx, foreign)).Should(Succeed())
+
+			By("creating the DaemonJob")
+			daemonJob := newDaemonJob(ConflictDaemonJobName)
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("checking the JobConflict condition")
+			Eventually(func() *metav1.Condition {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return nil
+				}
+				return meta.FindStatusCondition(daemonJob.Status.Conditions, daemonv1beta1.DaemonJobJobConflict)
+			}, timeout, interval).ShouldNot(BeNil())
+			condition := meta.FindStatusCondition(daemonJob.Status.Conditions, daemonv1beta1.DaemonJobJobConflict)
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Message).To(ContainSubstring(foreign.Name))
+
+			By("checking that the foreign Job has been left alone")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(foreign), foreign)).Should(Succeed())
+			Expect(metav1.GetControllerOf(foreign)).To(BeNil())
+		})
+	})
+	Context("When deleting a DaemonJob", func() {
+		ctx := context.Background()
+
+		const (
+			TeardownDaemonJobName = "teardown-daemonjob"
+			OrphanDaemonJobName   = "orphan-daemonjob"
+		)
+
+		jobTemplate := daemonv1beta1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{
+							{
+								Name:  "test",
+								Image: "busybox",
+							},
+						},
+						RestartPolicy: v1.RestartPolicyOnFailure,
+					},
+				},
+			},
+		}
+		complete := func(job *batchv1.Job) {
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			job.Status.CompletionTime = &now
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+		}
+
+		It("should run the teardown Job on the succeeded nodes before going away", func() {
+			By("creating a DaemonJob with a teardownTemplate")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      TeardownDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					JobTemplate:      jobTemplate,
+					TeardownTemplate: jobTemplate.DeepCopy(),
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("completing the Job of the node")
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: TeardownDaemonJobName + "-" + NodeName, Namespace: Namespace}, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			complete(job)
+
+			Eventually(func() daemonv1beta1.NodePhase {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return ""
+				}
+				for _, node := range daemonJob.Status.Nodes {
+					if node.NodeName == NodeName {
+						return node.Phase
+					}
+				}
+				return ""
+			}, timeout, interval).Should(Equal(daemonv1beta1.NodeSucceeded))
+			Expect(daemonJob.Finalizers).To(ContainElement(daemonJobFinalizer))
+
+			By("deleting the DaemonJob")
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+
+			teardownJob := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: TeardownDaemonJobName + "-" + NodeName + "-" + teardownStage, Namespace: Namespace}, teardownJob)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Consistently(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), &daemonv1beta1.DaemonJob{})
+			}, time.Second, interval).ShouldNot(HaveOccurred())
+
+			By("completing the teardown Job")
+			complete(teardownJob)
+
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), &daemonv1beta1.DaemonJob{}))
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("should release the Jobs with the Orphan deletion policy", func() {
+			By("creating a DaemonJob with the Orphan deletion policy")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      OrphanDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					JobTemplate:    jobTemplate,
+					DeletionPolicy: daemonv1beta1.DeletionPolicyOrphan,
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			job := &batchv1.Job{}
+			jobLookupKey := types.NamespacedName{Name: OrphanDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return nil
+				}
+				return daemonJob.Finalizers
+			}, timeout, interval).Should(ContainElement(daemonJobFinalizer))
+
+			By("deleting the DaemonJob")
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), &daemonv1beta1.DaemonJob{}))
+			}, timeout, interval).Should(BeTrue())
+			Expect(k8sClient.Get(ctx, jobLookupKey, job)).Should(Succeed())
+			Expect(metav1.GetControllerOf(job)).To(BeNil())
+		})
+	})
+	Context("When a rerun is requested", func() {
+		ctx := context.Background()
+
+		const RerunDaemonJobName = "rerun-daemonjob"
+
+		It("should replace the Jobs of the failed nodes", func() {
+			By("creating a DaemonJob")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RerunDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("failing the Job of the node")
+			job := &batchv1.Job{}
+			jobLookupKey := types.NamespacedName{Name: RerunDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			failedUID := job.UID
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			Eventually(func() int32 {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil || daemonJob.Status.FailedJobs == nil {
+					return 0
+				}
+				return *daemonJob.Status.FailedJobs
+			}, timeout, interval).Should(BeEquivalentTo(1))
+
+			By("requesting a rerun of the failed nodes")
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return err
+				}
+				daemonJob.Annotations = map[string]string{
+					rerunAnnotation:      "retry-1",
+					rerunScopeAnnotation: rerunScopeFailed,
+				}
+				return k8sClient.Update(ctx, daemonJob)
+			}, timeout, interval).Should(Succeed())
+
+			By("checking that the Job has been replaced")
+			Eventually(func() types.UID {
+				if err := k8sClient.Get(ctx, jobLookupKey, job); err != nil {
+					return ""
+				}
+				return job.UID
+			}, timeout, interval).ShouldNot(Or(BeEmpty(), Equal(failedUID)))
+
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return ""
+				}
+				return daemonJob.Status.RerunToken
+			}, timeout, interval).Should(Equal("retry-1"))
+		})
+	})
+
+	Context("When the Job of a node with a retry policy fails", func() {
+		It("Should retry the node", func() {
+			const RetryDaemonJobName = "test-retry-daemonjob"
+			ctx := context.Background()
+
+			By("creating a DaemonJob with a node retry policy")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RetryDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					NodeRetryPolicy: &daemonv1beta1.NodeRetryPolicy{MaxRetries: 1},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("failing the Job of the node")
+			job := &batchv1.Job{}
+			jobLookupKey := types.NamespacedName{Name: RetryDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			failedUID := job.UID
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the Job has been created again")
+			Eventually(func() types.UID {
+				if err := k8sClient.Get(ctx, jobLookupKey, job); err != nil {
+					return ""
+				}
+				return job.UID
+			}, timeout, interval).ShouldNot(Or(BeEmpty(), Equal(failedUID)))
+
+			Eventually(func() int32 {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return 0
+				}
+				for _, node := range daemonJob.Status.Nodes {
+					if node.NodeName == NodeName {
+						return node.Retries
+					}
+				}
+				return 0
+			}, timeout, interval).Should(BeEquivalentTo(1))
+		})
+	})
+
+	Context("When the Job of a node with an OOM retry is OOMKilled", func() {
+		It("Should create the Job again with more memory", func() {
+			const OOMDaemonJobName = "test-oom-daemonjob"
+			ctx := context.Background()
+
+			By("creating a DaemonJob with an OOM retry")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      OOMDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					OOMRetry: &daemonv1beta1.OOMRetry{MaxMemory: resource.MustParse("1Gi")},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+											Resources: v1.ResourceRequirements{
+												Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Mi")},
+											},
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			job := &batchv1.Job{}
+			jobLookupKey := types.NamespacedName{Name: OOMDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			failedUID := job.UID
+
+			By("killing the pod of the Job for lack of memory")
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      OOMDaemonJobName + "-pod",
+					Namespace: Namespace,
+					Labels:    map[string]string{"controller-uid": string(job.UID)},
+				},
+				Spec: *job.Spec.Template.Spec.DeepCopy(),
+			}
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+			pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+				Name:  "test-container",
+				Image: "busybox",
+				State: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+				},
+			}}
+			Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the Job has been created again with twice the memory")
+			Eventually(func() types.UID {
+				if err := k8sClient.Get(ctx, jobLookupKey, job); err != nil {
+					return ""
+				}
+				return job.UID
+			}, timeout, interval).ShouldNot(Or(BeEmpty(), Equal(failedUID)))
+			Expect(job.Spec.Template.Spec.Containers[0].Resources.Limits.Memory().Value()).To(Equal(int64(128 * 1024 * 1024)))
+
+			Eventually(func() int32 {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return 0
+				}
+				return memoryBumps(daemonJob, NodeName)
+			}, timeout, interval).Should(BeEquivalentTo(1))
+		})
+	})
+
+	Context("When the Job of a node with an onFailure job fails", func() {
+		It("Should run the onFailure job on the node", func() {
+			const OnFailureDaemonJobName = "test-on-failure-daemonjob"
+			ctx := context.Background()
+
+			jobTemplate := daemonv1beta1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								{
+									Name:  "test-container",
+									Image: "busybox",
+								},
+							},
+							RestartPolicy: v1.RestartPolicyOnFailure,
+						},
+					},
+				},
+			}
+
+			By("creating a DaemonJob with an onFailure job")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      OnFailureDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					JobTemplate: jobTemplate,
+					OnFailure: &daemonv1beta1.OnFailureSpec{
+						JobTemplate: jobTemplate.DeepCopy(),
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("failing the Job of the node")
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: OnFailureDaemonJobName + "-" + NodeName, Namespace: Namespace}, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("completing the onFailure job of the node")
+			onFailureJob := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: OnFailureDaemonJobName + "-" + NodeName + "-on-failure", Namespace: Namespace}, onFailureJob)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			onFailureJob.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, onFailureJob)).Should(Succeed())
+
+			By("checking the result of the onFailure job in the status")
+			Eventually(func() daemonv1beta1.NodePhase {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return ""
+				}
+				for _, node := range daemonJob.Status.Nodes {
+					if node.NodeName == NodeName {
+						return node.OnFailure
+					}
+				}
+				return ""
+			}, timeout, interval).Should(Equal(daemonv1beta1.NodeSucceeded))
+			Expect(daemonJob.Status.Nodes[0].Phase).To(Equal(daemonv1beta1.NodeFailed))
+		})
+	})
+
+	Context("When the Job of a node with a quarantine fails", func() {
+		It("Should quarantine the node until a later Job succeeds", func() {
+			const QuarantineDaemonJobName = "test-quarantine-daemonjob"
+			ctx := context.Background()
+
+			taint := v1.Taint{Key: "hardening.example.com/failed", Effect: v1.TaintEffectNoSchedule}
+			hasQuarantine := func() bool {
+				node := &v1.Node{}
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+					return false
+				}
+				return hasTaint(node, &taint) && node.Labels["hardening.example.com/state"] == "failed" &&
+					hasNodeOwner(node, quarantineAnnotation, Namespace+"/"+QuarantineDaemonJobName)
+			}
+
+			By("creating a DaemonJob quarantining the failed nodes")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      QuarantineDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					OnFailure: &daemonv1beta1.OnFailureSpec{
+						NodeAction: &daemonv1beta1.NodeAction{
+							Taint:  &taint,
+							Labels: map[string]string{"hardening.example.com/state": "failed"},
+						},
+					},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("failing the Job of the node")
+			job := &batchv1.Job{}
+			jobLookupKey := types.NamespacedName{Name: QuarantineDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobLookupKey, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			failedUID := job.UID
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the node is quarantined")
+			Eventually(hasQuarantine, timeout, interval).Should(BeTrue())
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return false
+				}
+				return len(daemonJob.Status.Nodes) > 0 && daemonJob.Status.Nodes[0].Quarantined
+			}, timeout, interval).Should(BeTrue())
+
+			By("rerunning the node successfully")
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return err
+				}
+				daemonJob.Annotations = map[string]string{rerunAnnotation: "quarantine-1"}
+				return k8sClient.Update(ctx, daemonJob)
+			}, timeout, interval).Should(Succeed())
+			Eventually(func() types.UID {
+				if err := k8sClient.Get(ctx, jobLookupKey, job); err != nil {
+					return ""
+				}
+				return job.UID
+			}, timeout, interval).ShouldNot(Or(BeEmpty(), Equal(failedUID)))
+			Expect(hasQuarantine()).To(BeTrue())
+
+			By("checking that the Job created after the quarantine tolerates its taint")
+			Expect(job.Spec.Template.Spec.Tolerations).To(ContainElement(v1.Toleration{
+				Key:      taint.Key,
+				Operator: v1.TolerationOpExists,
+				Effect:   taint.Effect,
+			}))
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the quarantine is lifted")
+			Eventually(hasQuarantine, timeout, interval).Should(BeFalse())
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+		})
+	})
+
+	Context("When the Job of a node with onSuccess labels succeeds", func() {
+		It("Should label the node until the DaemonJob is deleted", func() {
+			const MarkDaemonJobName = "test-mark-daemonjob"
+			ctx := context.Background()
+
+			nodeLabel := func() string {
+				node := &v1.Node{}
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+					return ""
+				}
+				return node.Labels["gpu-driver.example.com/installed"]
+			}
+
+			By("creating a DaemonJob labeling the succeeded nodes")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MarkDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					OnSuccess: &daemonv1beta1.OnSuccessSpec{
+						NodeLabels: map[string]string{"gpu-driver.example.com/installed": "v535"},
+					},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("completing the Job of the node")
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: MarkDaemonJobName + "-" + NodeName, Namespace: Namespace}, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the node is labeled")
+			Eventually(nodeLabel, timeout, interval).Should(Equal("v535"))
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return false
+				}
+				return len(daemonJob.Status.Nodes) > 0 && daemonJob.Status.Nodes[0].Marked
+			}, timeout, interval).Should(BeTrue())
+			node := &v1.Node{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node)).Should(Succeed())
+			Expect(hasNodeOwner(node, marksAnnotation, Namespace+"/"+MarkDaemonJobName)).To(BeTrue())
+
+			By("deleting the DaemonJob")
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+			Eventually(nodeLabel, timeout, interval).Should(BeEmpty())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node)).Should(Succeed())
+			Expect(node.Annotations).NotTo(HaveKey(marksAnnotation))
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob))
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("When the Job of a bootstrapping node succeeds", func() {
+		It("Should remove the bootstrapping taint of the node", func() {
+			const BootstrapDaemonJobName = "test-bootstrap-daemonjob"
+			ctx := context.Background()
+
+			taint := v1.Taint{Key: "node.example.com/bootstrapping", Effect: v1.TaintEffectNoSchedule}
+			isBootstrapping := func() bool {
+				node := &v1.Node{}
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+					return false
+				}
+				return hasTaint(node, &taint)
+			}
+
+			By("tainting the node")
+			node := &v1.Node{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node)).Should(Succeed())
+			patch := client.MergeFrom(node.DeepCopy())
+			node.Spec.Taints = append(node.Spec.Taints, taint)
+			Expect(k8sClient.Patch(ctx, node, patch)).Should(Succeed())
+
+			By("creating a DaemonJob removing the taint on success")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      BootstrapDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					OnSuccess: &daemonv1beta1.OnSuccessSpec{
+						RemoveTaints: []daemonv1beta1.TaintSelector{{Key: taint.Key}},
+					},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+										},
+									},
+									Tolerations: []v1.Toleration{
+										{Key: taint.Key, Operator: v1.TolerationOpExists},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: BootstrapDaemonJobName + "-" + NodeName, Namespace: Namespace}, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Expect(isBootstrapping()).To(BeTrue())
+
+			By("completing the Job of the node")
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the taint is removed")
+			Eventually(isBootstrapping, timeout, interval).Should(BeFalse())
+		})
+	})
+
+	Context("When a DaemonJob drains the nodes", func() {
+		It("Should cordon and drain the node until its Job succeeds", func() {
+			const MaintenanceDaemonJobName = "test-maintenance-daemonjob"
+			ctx := context.Background()
+
+			isCordoned := func() bool {
+				node := &v1.Node{}
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+					return false
+				}
+				return node.Spec.Unschedulable && node.Annotations[maintenanceAnnotation] == Namespace+"/"+MaintenanceDaemonJobName
+			}
+
+			By("running a pod on the node")
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-maintenance-pod",
+					Namespace: Namespace,
+				},
+				Spec: v1.PodSpec{
+					NodeName: NodeName,
+					Containers: []v1.Container{
+						{
+							Name:  "test-container",
+							Image: "busybox",
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+
+			By("creating a DaemonJob draining the nodes")
+			gracePeriodSeconds := int64(0)
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MaintenanceDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					Maintenance: &daemonv1beta1.MaintenanceSpec{
+						Drain: &daemonv1beta1.DrainSpec{
+							GracePeriodSeconds: &gracePeriodSeconds,
+							Force:              true,
+						},
+					},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("checking that the node is cordoned and drained")
+			Eventually(isCordoned, timeout, interval).Should(BeTrue())
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod))
+			}, timeout, interval).Should(BeTrue())
+
+			By("checking that the Job tolerates the cordoned node")
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: MaintenanceDaemonJobName + "-" + NodeName, Namespace: Namespace}, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Expect(job.Spec.Template.Spec.Tolerations).To(ContainElement(v1.Toleration{
+				Key:      v1.TaintNodeUnschedulable,
+				Operator: v1.TolerationOpExists,
+				Effect:   v1.TaintEffectNoSchedule,
+			}))
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil {
+					return false
+				}
+				return len(daemonJob.Status.Nodes) > 0 && daemonJob.Status.Nodes[0].Cordoned
+			}, timeout, interval).Should(BeTrue())
+
+			By("completing the Job of the node")
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the node is uncordoned")
+			Eventually(isCordoned, timeout, interval).Should(BeFalse())
+			node := &v1.Node{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node)).Should(Succeed())
+			Expect(node.Spec.Unschedulable).To(BeFalse())
+
+			By("deleting the DaemonJob")
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob))
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("When the Job of a node requests a reboot", func() {
+		It("Should reboot the node and uncordon it once it is back", func() {
+			const RebootDaemonJobName = "test-reboot-daemonjob"
+			ctx := context.Background()
+
+			setBootID := func(bootID string) {
+				// the operator may patch the node meanwhile
+				Eventually(func() error {
+					node := &v1.Node{}
+					if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+						return err
+					}
+					node.Status.NodeInfo.BootID = bootID
+					node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+					return k8sClient.Status().Update(ctx, node)
+				}, timeout, interval).Should(Succeed())
+			}
+			isCordoned := func() bool {
+				node := &v1.Node{}
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+					return false
+				}
+				return node.Spec.Unschedulable
+			}
+			rebootPhase := func() daemonv1beta1.RebootPhase {
+				daemonJob := &daemonv1beta1.DaemonJob{}
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: RebootDaemonJobName, Namespace: Namespace}, daemonJob); err != nil {
+					return ""
+				}
+				if len(daemonJob.Status.Nodes) == 0 {
+					return ""
+				}
+				return daemonJob.Status.Nodes[0].Reboot
+			}
+			setBootID("boot-1")
+
+			By("creating a DaemonJob rebooting the nodes on request")
+			podSpec := v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:  "test-container",
+						Image: "busybox",
+					},
+				},
+				RestartPolicy: v1.RestartPolicyOnFailure,
+			}
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RebootDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					Reboot: &daemonv1beta1.RebootSpec{
+						JobTemplate: daemonv1beta1.JobTemplateSpec{
+							Spec: batchv1.JobSpec{Template: v1.PodTemplateSpec{Spec: *podSpec.DeepCopy()}},
+						},
+					},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{Template: v1.PodTemplateSpec{Spec: podSpec}},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("completing the Job of the node with the reboot message")
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: RebootDaemonJobName + "-" + NodeName, Namespace: Namespace}, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RebootDaemonJobName + "-pod",
+					Namespace: Namespace,
+					Labels:    map[string]string{"controller-uid": string(job.UID), daemonJobUIDLabel: string(daemonJob.UID)},
+				},
+				Spec: podSpec,
+			}
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+			pod.Status = v1.PodStatus{
+				Phase: v1.PodSucceeded,
+				ContainerStatuses: []v1.ContainerStatus{
+					{
+						Name:  "test-container",
+						Image: "busybox",
+						State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Message: "reboot-required\n"}},
+					},
+				},
+			}
+			Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the node is cordoned and the reboot job created")
+			rebootJob := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: RebootDaemonJobName + "-" + NodeName + "-reboot", Namespace: Namespace}, rebootJob)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			Expect(rebootJob.Annotations).To(HaveKeyWithValue(bootIDAnnotation, "boot-1"))
+			Expect(*rebootJob.Spec.BackoffLimit).To(BeZero())
+			Expect(rebootJob.Spec.Template.Spec.RestartPolicy).To(Equal(v1.RestartPolicyNever))
+			Expect(isCordoned()).To(BeTrue())
+			Eventually(rebootPhase, timeout, interval).Should(Equal(daemonv1beta1.Rebooting))
+
+			By("bringing the node back with a new boot ID")
+			setBootID("boot-2")
+			Eventually(rebootPhase, timeout, interval).Should(Equal(daemonv1beta1.Rebooted))
+			Eventually(isCordoned, timeout, interval).Should(BeFalse())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(rebootJob), rebootJob)
+				return errors.IsNotFound(err) || !rebootJob.DeletionTimestamp.IsZero()
+			}, timeout, interval).Should(BeTrue())
+
+			By("deleting the DaemonJob")
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob))
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("When a node is about to be scaled down", func() {
+		It("Should skip the node until the taint is removed", func() {
+			const ScaleDownDaemonJobName = "test-scale-down-daemonjob"
+			ctx := context.Background()
+
+			taint := v1.Taint{Key: scaleDownCandidateTaint, Value: "1700000000", Effect: v1.TaintEffectNoSchedule}
+			patchTaints := func(mutate func(*v1.Node)) {
+				Eventually(func() error {
+					node := &v1.Node{}
+					if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+						return err
+					}
+					patch := client.MergeFromWithOptions(node.DeepCopy(), client.MergeFromWithOptimisticLock{})
+					mutate(node)
+					return k8sClient.Patch(ctx, node, patch)
+				}, timeout, interval).Should(Succeed())
+			}
+
+			By("tainting the node for its scale down")
+			patchTaints(func(node *v1.Node) {
+				node.Spec.Taints = append(node.Spec.Taints, taint)
+			})
+
+			By("creating a DaemonJob skipping the scale-down candidates")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ScaleDownDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					NodeConditions: &daemonv1beta1.NodeConditionsSpec{
+						ScaleDownCandidate: daemonv1beta1.NodeConditionSkip,
+					},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("checking that the node is skipped with its reason")
+			Eventually(func() daemonv1beta1.NodeStatus {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(daemonJob), daemonJob); err != nil || len(daemonJob.Status.Nodes) == 0 {
+					return daemonv1beta1.NodeStatus{}
+				}
+				return daemonJob.Status.Nodes[0]
+			}, timeout, interval).Should(Equal(daemonv1beta1.NodeStatus{
+				NodeName: NodeName,
+				Phase:    daemonv1beta1.NodeSkipped,
+				Reason:   "skipped, node is a scale-down candidate",
+			}))
+			Expect(daemonJob.Status.DesiredNumberScheduled).To(BeZero())
+			jobKey := types.NamespacedName{Name: ScaleDownDaemonJobName + "-" + NodeName, Namespace: Namespace}
+			Consistently(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, jobKey, &batchv1.Job{}))
+			}, time.Second, interval).Should(BeTrue())
+
+			By("removing the taint")
+			patchTaints(func(node *v1.Node) {
+				removeTaint(node, &taint)
+			})
+			Eventually(func() error {
+				return k8sClient.Get(ctx, jobKey, &batchv1.Job{})
+			}, timeout, interval).ShouldNot(HaveOccurred())
+
+			By("deleting the DaemonJob")
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+		})
+	})
+
+	Context("When a DaemonJob maintains a node cordoned by someone else", func() {
+		It("Should claim the node and leave it cordoned", func() {
+			const CordonedDaemonJobName = "test-cordoned-daemonjob"
+			ctx := context.Background()
+
+			patchNode := func(mutate func(*v1.Node)) {
+				Eventually(func() error {
+					node := &v1.Node{}
+					if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+						return err
+					}
+					patch := client.MergeFromWithOptions(node.DeepCopy(), client.MergeFromWithOptimisticLock{})
+					mutate(node)
+					return k8sClient.Patch(ctx, node, patch)
+				}, timeout, interval).Should(Succeed())
+			}
+
+			By("cordoning the node")
+			patchNode(func(node *v1.Node) {
+				node.Spec.Unschedulable = true
+			})
+
+			By("creating a DaemonJob cordoning the nodes")
+			daemonJob := &daemonv1beta1.DaemonJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CordonedDaemonJobName,
+					Namespace: Namespace,
+				},
+				Spec: daemonv1beta1.DaemonJobSpec{
+					Maintenance: &daemonv1beta1.MaintenanceSpec{Cordon: true},
+					JobTemplate: daemonv1beta1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{
+										{
+											Name:  "test-container",
+											Image: "busybox",
+										},
+									},
+									RestartPolicy: v1.RestartPolicyOnFailure,
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, daemonJob)).Should(Succeed())
+
+			By("checking that the node is claimed")
+			node := &v1.Node{}
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+					return ""
+				}
+				return node.Annotations[maintenanceAnnotation]
+			}, timeout, interval).Should(Equal(Namespace + "/" + CordonedDaemonJobName))
+			Expect(node.Annotations).To(HaveKey(cordonedAnnotation))
+
+			By("completing the Job of the node")
+			job := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: CordonedDaemonJobName + "-" + NodeName, Namespace: Namespace}, job)
+			}, timeout, interval).ShouldNot(HaveOccurred())
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("checking that the node is released but left cordoned")
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: NodeName}, node); err != nil {
+					return false
+				}
+				_, claimed := node.Annotations[maintenanceAnnotation]
+				return claimed
+			}, timeout, interval).Should(BeFalse())
+			Expect(node.Annotations).NotTo(HaveKey(cordonedAnnotation))
+			Expect(node.Spec.Unschedulable).To(BeTrue())
+
+			By("uncordoning the node")
+			patchNode(func(node *v1.Node) {
+				node.Spec.Unschedulable = false
+			})
+			Expect(k8sClient.Delete(ctx, daemonJob)).Should(Succeed())
+		})
+	})
 })
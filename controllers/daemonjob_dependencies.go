@@ -0,0 +1,122 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const dependsOnKey = ".spec.dependsOn"
+
+// dependencyHolds adds to holds the nodes that have no Job yet and on which a
+// DaemonJob of spec.dependsOn has not succeeded, with the reason they are held.
+func (r *DaemonJobReconciler) dependencyHolds(ctx context.Context, dj *daemonv1beta1.DaemonJob, nodeList *v1.NodeList, jobs map[string]nodeJobs, holds map[string]string) error {
+	for _, dependency := range dj.Spec.DependsOn {
+		succeeded, err := r.succeededNodes(ctx, dj.Namespace, dependency.Name)
+		if err != nil {
+			return err
+		}
+
+		for _, node := range nodeList.Items {
+			// the Jobs already started on a node are not held back
+			if len(jobs[node.Name]) > 0 || succeeded[node.Name] {
+				continue
+			}
+			if _, held := holds[node.Name]; !held {
+				holds[node.Name] = fmt.Sprintf("waiting for DaemonJob %s to succeed on the node", dependency.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// succeededNodes returns the nodes on which the named DaemonJob succeeded.
+func (r *DaemonJobReconciler) succeededNodes(ctx context.Context, namespace, name string) (map[string]bool, error) {
+	var dj daemonv1beta1.DaemonJob
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &dj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var childJobs batchv1.JobList
+	if err := r.List(ctx, &childJobs,
+		client.InNamespace(namespace),
+		client.MatchingFields{daemonJobUIDKey: string(dj.UID)}); err != nil {
+		return nil, err
+	}
+
+	succeeded := make(map[string]bool)
+	for nodeName, jobs := range jobsByNode(&childJobs) {
+		status, _ := nodeProgress(&dj, nodeName, jobs)
+		if status.Phase == daemonv1beta1.NodeSucceeded {
+			succeeded[nodeName] = true
+		}
+	}
+
+	return succeeded, nil
+}
+
+func indexDependsOnField(rawObj client.Object) []string {
+	dj := rawObj.(*daemonv1beta1.DaemonJob)
+	names := make([]string, 0, len(dj.Spec.DependsOn))
+	for _, dependency := range dj.Spec.DependsOn {
+		names = append(names, dependency.Name)
+	}
+	return names
+}
+
+// mapToDependentDaemonJobs enqueues the DaemonJobs depending on the owner of a Job.
+func (r *DaemonJobReconciler) mapToDependentDaemonJobs(obj client.Object) []ctrl.Request {
+	owner := metav1.GetControllerOf(obj)
+	if !isDaemonJobOwner(owner) {
+		return nil
+	}
+
+	ctx := context.Background()
+	log := clog.FromContext(ctx)
+	daemonJobList := &daemonv1beta1.DaemonJobList{}
+	if err := r.List(ctx, daemonJobList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{dependsOnKey: owner.Name}); err != nil {
+		log.Error(err, "error getting list of dependent DaemonJob")
+		return nil
+	}
+
+	results := make([]ctrl.Request, 0, len(daemonJobList.Items))
+	for _, daemonJob := range daemonJobList.Items {
+		results = append(results, ctrl.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: daemonJob.GetNamespace(),
+				Name:      daemonJob.GetName(),
+			},
+		})
+	}
+	return results
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	reasonOutputDrift      = "OutputDrift"
+	reasonNoMajorityOutput = "NoMajorityOutput"
+	reasonConsistentOutput = "ConsistentOutput"
+	reasonInvalidJSONPath  = "InvalidJSONPath"
+)
+
+// setDriftStatus compares the outputs reported by the nodes and records the
+// drifted nodes in the status, along with the Degraded condition.
+func setDriftStatus(dj *daemonv1beta1.DaemonJob, status *daemonv1beta1.DaemonJobStatus, reports []daemonv1alpha1.NodeReport) {
+	if dj.Spec.ExpectConsistentOutput == nil {
+		status.Drift = nil
+		removeStatusCondition(&status.Conditions, daemonv1beta1.DaemonJobDegraded)
+		return
+	}
+
+	drift, err := outputDrift(dj.Spec.ExpectConsistentOutput, reports)
+	if err != nil {
+		status.Drift = nil
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    daemonv1beta1.DaemonJobDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonInvalidJSONPath,
+			Message: err.Error(),
+		})
+		return
+	}
+	status.Drift = drift
+
+	condition := metav1.Condition{
+		Type:    daemonv1beta1.DaemonJobDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  reasonConsistentOutput,
+		Message: fmt.Sprintf("%d node(s) report the same output", drift.ConsistentNodes),
+	}
+	if len(drift.DriftedNodes) > 0 {
+		nodeNames := make([]string, 0, len(drift.DriftedNodes))
+		for _, node := range drift.DriftedNodes {
+			nodeNames = append(nodeNames, node.NodeName)
+		}
+
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonOutputDrift
+		condition.Message = fmt.Sprintf("%d node(s) drifted from the majority output: %s",
+			len(nodeNames), strings.Join(nodeNames, ", "))
+		if drift.ExpectedValue == "" {
+			condition.Reason = reasonNoMajorityOutput
+			condition.Message = fmt.Sprintf("no output is reported by a majority of nodes: %s",
+				strings.Join(nodeNames, ", "))
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// outputDrift groups the nodes by the value selected from their output. The
+// value of the largest group is the expected one, and the nodes outside of it
+// are drifted. If several groups are the largest, every node is drifted.
+// Reports without output are ignored.
+func outputDrift(spec *daemonv1beta1.ConsistencySpec, reports []daemonv1alpha1.NodeReport) (*daemonv1beta1.DriftStatus, error) {
+	var parser *jsonpath.JSONPath
+	if spec.JSONPath != "" {
+		expression := spec.JSONPath
+		if !strings.HasPrefix(expression, "{") {
+			expression = fmt.Sprintf("{%s}", expression)
+		}
+
+		parser = jsonpath.New("drift").AllowMissingKeys(true)
+		if err := parser.Parse(expression); err != nil {
+			return nil, fmt.Errorf("invalid jsonPath %q: %v", spec.JSONPath, err)
+		}
+	}
+
+	values := make(map[string]string, len(reports))
+	groups := make(map[string]int32)
+	for _, report := range reports {
+		if report.Spec.Output == nil {
+			continue
+		}
+
+		value, err := outputValue(parser, report.Spec.Output.Raw)
+		if err != nil {
+			continue
+		}
+		values[report.Spec.NodeName] = value
+		groups[value]++
+	}
+
+	drift := &daemonv1beta1.DriftStatus{}
+	majority := false
+	for value, count := range groups {
+		switch {
+		case count > drift.ConsistentNodes:
+			drift.ExpectedValue = value
+			drift.ConsistentNodes = count
+			majority = true
+		case count == drift.ConsistentNodes:
+			majority = false
+		}
+	}
+	if !majority {
+		drift.ExpectedValue = ""
+		drift.ConsistentNodes = 0
+	}
+
+	for nodeName, value := range values {
+		if majority && value == drift.ExpectedValue {
+			continue
+		}
+		drift.DriftedNodes = append(drift.DriftedNodes, daemonv1beta1.DriftedNode{
+			NodeName: nodeName,
+			Value:    value,
+		})
+	}
+	sort.Slice(drift.DriftedNodes, func(i, j int) bool {
+		return drift.DriftedNodes[i].NodeName < drift.DriftedNodes[j].NodeName
+	})
+
+	return drift, nil
+}
+
+// outputValue returns the value selected by the parser from the raw output,
+// or the whole output in its compact form if there is no parser.
+func outputValue(parser *jsonpath.JSONPath, raw []byte) (string, error) {
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return "", err
+	}
+
+	if parser == nil {
+		// re-encoding sorts the keys of the objects
+		value, err := json.Marshal(data)
+		return string(value), err
+	}
+
+	var buf bytes.Buffer
+	if err := parser.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
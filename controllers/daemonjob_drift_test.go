@@ -0,0 +1,84 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Output drift", func() {
+
+	report := func(nodeName, output string) daemonv1alpha1.NodeReport {
+		return daemonv1alpha1.NodeReport{
+			Spec: daemonv1alpha1.NodeReportSpec{
+				NodeName: nodeName,
+				Output:   &apiextensionsv1.JSON{Raw: []byte(output)},
+			},
+		}
+	}
+
+	It("should flag the nodes outside of the majority", func() {
+		reports := []daemonv1alpha1.NodeReport{
+			report("node-a", `{"sysctl": {"swappiness": 10}, "kernel": "5.10"}`),
+			report("node-b", `{"kernel": "5.10", "sysctl": {"swappiness": 10}}`),
+			report("node-c", `{"kernel": "5.10", "sysctl": {"swappiness": 60}}`),
+		}
+
+		drift, err := outputDrift(&daemonv1beta1.ConsistencySpec{}, reports)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift.ExpectedValue).To(MatchJSON(`{"kernel": "5.10", "sysctl": {"swappiness": 10}}`))
+		Expect(drift.ConsistentNodes).To(BeEquivalentTo(2))
+		Expect(drift.DriftedNodes).To(HaveLen(1))
+		Expect(drift.DriftedNodes[0].NodeName).To(Equal("node-c"))
+	})
+
+	It("should only compare the value selected by the jsonPath", func() {
+		reports := []daemonv1alpha1.NodeReport{
+			report("node-a", `{"kernel": "5.10", "sysctl": {"swappiness": 10}}`),
+			report("node-b", `{"kernel": "5.4", "sysctl": {"swappiness": 10}}`),
+			report("node-c", `{"kernel": "5.10", "sysctl": {"swappiness": 60}}`),
+		}
+
+		drift, err := outputDrift(&daemonv1beta1.ConsistencySpec{JSONPath: ".kernel"}, reports)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift.ExpectedValue).To(Equal("5.10"))
+		Expect(drift.DriftedNodes).To(ConsistOf(daemonv1beta1.DriftedNode{NodeName: "node-b", Value: "5.4"}))
+	})
+
+	It("should flag every node when there is no majority", func() {
+		reports := []daemonv1alpha1.NodeReport{
+			report("node-a", `{"kernel": "5.10"}`),
+			report("node-b", `{"kernel": "5.4"}`),
+		}
+
+		drift, err := outputDrift(&daemonv1beta1.ConsistencySpec{JSONPath: "{.kernel}"}, reports)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift.ExpectedValue).To(BeEmpty())
+		Expect(drift.DriftedNodes).To(HaveLen(2))
+	})
+
+	It("should fail on an invalid jsonPath", func() {
+		_, err := outputDrift(&daemonv1beta1.ConsistencySpec{JSONPath: "{.kernel"}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
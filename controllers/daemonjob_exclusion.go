@@ -0,0 +1,179 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	exclusionGroupKey = ".spec.exclusionGroup"
+
+	// exclusionRequeueDelay is how long a DaemonJob waits before checking
+	// again the nodes locked by its exclusion group.
+	exclusionRequeueDelay = 10 * time.Second
+)
+
+// exclusionLocks serializes the reconciles of the DaemonJobs and
+// ClusterDaemonJobs of an exclusion group. It is shared by the reconcilers,
+// which hold the lock of the group from the check of its active Jobs until
+// the creation of their own, so that two members of the group never start a
+// Job on the same node.
+type exclusionLocks struct {
+	mu sync.Mutex
+
+	// groups are the locks of the exclusion groups
+	groups map[string]*sync.Mutex
+}
+
+func newExclusionLocks() *exclusionLocks {
+	return &exclusionLocks{groups: make(map[string]*sync.Mutex)}
+}
+
+// lock locks the exclusion group, and returns the function unlocking it.
+// Nothing is locked without a group.
+func (l *exclusionLocks) lock(group string) func() {
+	if group == "" {
+		return func() {}
+	}
+
+	l.mu.Lock()
+	groupLock, ok := l.groups[group]
+	if !ok {
+		groupLock = &sync.Mutex{}
+		l.groups[group] = groupLock
+	}
+	l.mu.Unlock()
+
+	groupLock.Lock()
+	return groupLock.Unlock
+}
+
+// exclusionHolds adds to holds the nodes where another DaemonJob or
+// ClusterDaemonJob of the exclusion group has an active Job, and returns
+// whether any node is locked.
+func (r *DaemonJobReconciler) exclusionHolds(ctx context.Context, dj *daemonv1beta1.DaemonJob, holds map[string]string) (bool, error) {
+	if dj.Spec.ExclusionGroup == "" {
+		return false, nil
+	}
+
+	var group daemonv1beta1.DaemonJobList
+	if err := r.List(ctx, &group, client.MatchingFields{exclusionGroupKey: dj.Spec.ExclusionGroup}); err != nil {
+		return false, err
+	}
+	var clusterGroup daemonv1alpha1.ClusterDaemonJobList
+	if err := r.List(ctx, &clusterGroup, client.MatchingFields{exclusionGroupKey: dj.Spec.ExclusionGroup}); err != nil {
+		return false, err
+	}
+
+	excluded := false
+	lock := func(nodeNames []string, holder string) {
+		for _, nodeName := range nodeNames {
+			excluded = true
+			if _, held := holds[nodeName]; !held {
+				holds[nodeName] = fmt.Sprintf("%s of exclusion group %s is running on the node",
+					holder, dj.Spec.ExclusionGroup)
+			}
+		}
+	}
+
+	for i := range group.Items {
+		other := &group.Items[i]
+		if other.UID == dj.UID {
+			continue
+		}
+
+		selector := client.MatchingLabels{daemonJobUIDLabel: string(other.UID)}
+		nodeNames, err := r.activeNodes(ctx, other.Namespace, selector, func(job *batchv1.Job) bool {
+			owner := metav1.GetControllerOf(job)
+			return owner != nil && owner.UID == other.UID
+		})
+		if err != nil {
+			return false, err
+		}
+		lock(nodeNames, fmt.Sprintf("DaemonJob %s/%s", other.Namespace, other.Name))
+	}
+
+	for i := range clusterGroup.Items {
+		other := &clusterGroup.Items[i]
+		if other.UID == dj.UID {
+			continue
+		}
+
+		selector := client.MatchingLabels{clusterDaemonJobLabel: labelValue(other.Name)}
+		nodeNames, err := r.activeNodes(ctx, other.Spec.TargetNamespace, selector, func(job *batchv1.Job) bool {
+			return job.Annotations[clusterDaemonJobAnnotation] == other.Name
+		})
+		if err != nil {
+			return false, err
+		}
+		lock(nodeNames, fmt.Sprintf("ClusterDaemonJob %s", other.Name))
+	}
+
+	return excluded, nil
+}
+
+// activeNodes returns the nodes where the Jobs matching the selector and
+// selected by owns are active. The Jobs are read from the API server, as a Job
+// created by a previous reconcile may not be in the cache yet.
+func (r *DaemonJobReconciler) activeNodes(ctx context.Context, namespace string, selector client.MatchingLabels, owns func(job *batchv1.Job) bool) ([]string, error) {
+	var jobs batchv1.JobList
+	if err := r.APIReader.List(ctx, &jobs, client.InNamespace(namespace), selector); err != nil {
+		return nil, err
+	}
+
+	var nodeNames []string
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if !owns(job) {
+			continue
+		}
+
+		nodeName, ok := job.Annotations[annotation]
+		if !ok || jobStatus(*job) != "" {
+			continue
+		}
+		nodeNames = append(nodeNames, nodeName)
+	}
+
+	return nodeNames, nil
+}
+
+func indexExclusionGroupField(rawObj client.Object) []string {
+	dj := rawObj.(*daemonv1beta1.DaemonJob)
+	if dj.Spec.ExclusionGroup == "" {
+		return nil
+	}
+	return []string{dj.Spec.ExclusionGroup}
+}
+
+func indexClusterExclusionGroupField(rawObj client.Object) []string {
+	cdj := rawObj.(*daemonv1alpha1.ClusterDaemonJob)
+	if cdj.Spec.ExclusionGroup == "" {
+		return nil
+	}
+	return []string{cdj.Spec.ExclusionGroup}
+}
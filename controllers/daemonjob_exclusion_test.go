@@ -0,0 +1,47 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exclusion locks", func() {
+
+	It("should serialize the reconciles of a group", func() {
+		locks := newExclusionLocks()
+		unlock := locks.lock("containerd")
+
+		locked := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			locks.lock("containerd")()
+			close(locked)
+		}()
+		Consistently(locked, 100*time.Millisecond).ShouldNot(BeClosed())
+
+		// the other groups and the DaemonJobs without a group are not locked
+		locks.lock("kubelet")()
+		locks.lock("")()
+
+		unlock()
+		Eventually(locked).Should(BeClosed())
+	})
+})
@@ -1,13 +1,21 @@
 package controllers
 
 import (
-	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // NewPod creates a new pod
-func NewPod(dj *daemonv1alpha1.DaemonJob, nodeName string) *v1.Pod {
+func NewPod(dj *daemonv1beta1.DaemonJob, nodeName string) *v1.Pod {
 	newPod := &v1.Pod{Spec: dj.Spec.JobTemplate.Spec.Template.Spec, ObjectMeta: dj.Spec.JobTemplate.ObjectMeta}
 	newPod.Namespace = dj.Namespace
 	newPod.Spec.NodeName = nodeName
@@ -31,3 +39,41 @@ func jobStatus(job batchv1.Job) batchv1.JobConditionType {
 
 	return finishedType
 }
+
+// templateHash returns a short hash of the job template, so that a Job can
+// tell which template it was created from.
+func templateHash(template *daemonv1beta1.JobTemplateSpec) string {
+	hasher := fnv.New32a()
+	// json encoding of structs and maps is stable
+	data, _ := json.Marshal(template)
+	_, _ = hasher.Write(data)
+
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// labelValue returns value if it is a valid label value, or a truncated
+// value suffixed with its hash otherwise.
+func labelValue(value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(value))
+	hash := rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+
+	prefix := value
+	if max := validation.LabelValueMaxLength - len(hash) - 1; len(prefix) > max {
+		prefix = prefix[:max]
+	}
+
+	return fmt.Sprintf("%s-%s", prefix, hash)
+}
+
+// removeStatusCondition removes the condition of the given type, if any.
+// meta.RemoveStatusCondition panics on an empty list of conditions.
+func removeStatusCondition(conditions *[]metav1.Condition, conditionType string) {
+	if meta.FindStatusCondition(*conditions, conditionType) != nil {
+		meta.RemoveStatusCondition(conditions, conditionType)
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// maintenanceAnnotation records on a node the DaemonJob that cordoned it.
+	maintenanceAnnotation = "daemon.justk8s.com/maintenance"
+	// cordonedAnnotation records on a node that it was cordoned by someone
+	// else before its maintenance, so that it is left cordoned after it.
+	cordonedAnnotation = "daemon.justk8s.com/cordoned"
+	podNodeNameKey        = "spec.nodeName"
+
+	// the pods being evicted are checked again after this delay
+	drainRequeueDelay = 10 * time.Second
+
+	eventReasonCordon   = "Cordon"
+	eventReasonUncordon = "Uncordon"
+)
+
+// maintainsNodes reports whether the DaemonJob cordons the nodes around their jobs.
+func maintainsNodes(dj *daemonv1beta1.DaemonJob) bool {
+	m := dj.Spec.Maintenance
+	return m != nil && (m.Cordon || m.Drain != nil)
+}
+
+// nodeOwner returns the value recording the DaemonJob in the annotations of
+// the nodes it cordons, quarantines or marks.
+func nodeOwner(dj *daemonv1beta1.DaemonJob) string {
+	return dj.Namespace + "/" + dj.Name
+}
+
+// maxMaintenanceNodes returns how many of the nodes of the DaemonJob may be in
+// maintenance at once, a percentage being rounded up.
+func maxMaintenanceNodes(maintenance *daemonv1beta1.MaintenanceSpec, nodes int) int {
+	if maintenance.MaxConcurrentNodes == nil {
+		return daemonv1beta1.DefaultMaxMaintenanceNodes
+	}
+	maxNodes, err := intstr.GetScaledValueFromIntOrPercent(maintenance.MaxConcurrentNodes, nodes, true)
+	if err != nil {
+		return daemonv1beta1.DefaultMaxMaintenanceNodes
+	}
+	return maxNodes
+}
+
+// maintenanceHolds cordons, and drains if requested, the nodes about to get a
+// Job, up to the cap of spec.maintenance. The nodes without a free slot, owned
+// by another DaemonJob or still draining are held back. A node cordoned by
+// someone else is claimed like the others, and left cordoned after its
+// maintenance. It returns whether a node is draining, to check its pods again
+// later.
+func (r *DaemonJobReconciler) maintenanceHolds(ctx context.Context, dj *daemonv1beta1.DaemonJob, nodeList *v1.NodeList, jobs map[string]nodeJobs, holds map[string]string) (bool, error) {
+	if !maintainsNodes(dj) {
+		return false, nil
+	}
+	maintenance := dj.Spec.Maintenance
+	owner := nodeOwner(dj)
+
+	var nodes, maintained int
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if shouldRun, _ := r.nodeShouldRunDaemonJob(node, dj); shouldRun {
+			nodes++
+		}
+		if node.Annotations[maintenanceAnnotation] == owner {
+			maintained++
+		}
+	}
+	maxNodes := maxMaintenanceNodes(maintenance, nodes)
+
+	var draining bool
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if shouldRun, _ := r.nodeShouldRunDaemonJob(node, dj); !shouldRun {
+			continue
+		}
+		if _, held := holds[node.Name]; held {
+			continue
+		}
+		if _, next := nodeProgress(dj, node.Name, jobs[node.Name]); next == nil {
+			continue
+		}
+
+		if !r.NodeActions {
+			holds[node.Name] = "waiting for maintenance, node actions are disabled in the operator"
+			continue
+		}
+
+		switch current := node.Annotations[maintenanceAnnotation]; {
+		case current == owner:
+		case current != "":
+			holds[node.Name] = fmt.Sprintf("waiting for the maintenance of %s", current)
+			continue
+		case maintained >= maxNodes:
+			holds[node.Name] = fmt.Sprintf("waiting for maintenance, %d node(s) in maintenance", maintained)
+			continue
+		default:
+			cordoned := node.Spec.Unschedulable
+			if err := r.cordon(ctx, owner, node); err != nil {
+				return false, err
+			}
+			maintained++
+			if !cordoned {
+				r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonCordon, "Cordoned node %s for its Job", node.Name)
+			}
+		}
+
+		if maintenance.Drain == nil {
+			continue
+		}
+		reason, err := r.drainNode(ctx, dj, maintenance.Drain, node.Name)
+		if err != nil {
+			return false, err
+		}
+		if reason != "" {
+			holds[node.Name] = reason
+			draining = true
+		}
+	}
+
+	return draining, nil
+}
+
+// drainNode evicts the pods of the node, but the pods of DaemonSets, the
+// mirror pods and the pods of the DaemonJob. It returns why the node is not
+// drained yet, or an empty string. The evictions refused by a
+// PodDisruptionBudget are tried again on a later reconcile.
+func (r *DaemonJobReconciler) drainNode(ctx context.Context, dj *daemonv1beta1.DaemonJob, drain *daemonv1beta1.DrainSpec, nodeName string) (string, error) {
+	var pods v1.PodList
+	if err := r.List(ctx, &pods, client.MatchingFields{podNodeNameKey: nodeName}); err != nil {
+		return "", err
+	}
+
+	var left int
+	var blocked string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if _, mirror := pod.Annotations[v1.MirrorPodAnnotationKey]; mirror {
+			continue
+		}
+		controller := metav1.GetControllerOf(pod)
+		if controller != nil && controller.Kind == "DaemonSet" {
+			continue
+		}
+		if pod.Labels[daemonJobUIDLabel] == string(dj.UID) {
+			continue
+		}
+
+		left++
+		switch {
+		case pod.DeletionTimestamp != nil:
+			continue
+		case controller == nil && !drain.Force:
+			blocked = fmt.Sprintf("pod %s/%s is not managed by a controller", pod.Namespace, pod.Name)
+			continue
+		case usesEmptyDir(pod) && !drain.DeleteEmptyDirData:
+			blocked = fmt.Sprintf("pod %s/%s uses emptyDir data", pod.Namespace, pod.Name)
+			continue
+		}
+
+		eviction := &policyv1beta1.Eviction{
+			ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: drain.GracePeriodSeconds},
+		}
+		err := r.kubeClient.PolicyV1beta1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		switch {
+		case err == nil:
+		case errors.IsNotFound(err):
+			left--
+		case errors.IsTooManyRequests(err):
+			// a PodDisruptionBudget refused the eviction for now
+		default:
+			return "", err
+		}
+	}
+
+	switch {
+	case left == 0:
+		return "", nil
+	case blocked != "":
+		return fmt.Sprintf("draining, %s", blocked), nil
+	default:
+		return fmt.Sprintf("draining, %d pod(s) left", left), nil
+	}
+}
+
+// usesEmptyDir reports whether the pod has an emptyDir volume.
+func usesEmptyDir(pod *v1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileMaintenance uncordons the nodes cordoned by the DaemonJob where it
+// succeeded and no reboot is pending, that it left, or all of them if it does
+// not maintain nor reboot the nodes anymore. The failed nodes stay cordoned,
+// and keep their slot. The cordoned nodes are recorded in the status.
+func (r *DaemonJobReconciler) reconcileMaintenance(ctx context.Context, dj *daemonv1beta1.DaemonJob, status *daemonv1beta1.DaemonJobStatus, nodeList *v1.NodeList) error {
+	if !r.NodeActions {
+		return nil
+	}
+	owner := nodeOwner(dj)
+
+	statuses := make(map[string]*daemonv1beta1.NodeStatus, len(status.Nodes))
+	for i := range status.Nodes {
+		statuses[status.Nodes[i].NodeName] = &status.Nodes[i]
+	}
+
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if node.Annotations[maintenanceAnnotation] != owner {
+			continue
+		}
+		nodeStatus := statuses[node.Name]
+		if nodeStatus != nil && ((maintainsNodes(dj) && nodeStatus.Phase != daemonv1beta1.NodeSucceeded) || rebootPending(nodeStatus)) {
+			nodeStatus.Cordoned = true
+			continue
+		}
+		if err := r.uncordon(ctx, owner, node); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonUncordon, "Uncordoned node %s", node.Name)
+	}
+
+	return nil
+}
+
+// uncordonAllNodes uncordons every node cordoned by a deleted DaemonJob.
+func (r *DaemonJobReconciler) uncordonAllNodes(ctx context.Context, dj *daemonv1beta1.DaemonJob, nodeList *v1.NodeList) error {
+	if !r.NodeActions {
+		return nil
+	}
+	owner := nodeOwner(dj)
+
+	for i := range nodeList.Items {
+		if nodeList.Items[i].Annotations[maintenanceAnnotation] != owner {
+			continue
+		}
+		if err := r.uncordon(ctx, owner, &nodeList.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cordon marks the node unschedulable, and records the owner of the
+// maintenance in its annotation. A node cordoned by someone else is recorded
+// as such.
+func (r *DaemonJobReconciler) cordon(ctx context.Context, owner string, node *v1.Node) error {
+	return r.patchNode(ctx, node, func(node *v1.Node) {
+		if node.Annotations == nil {
+			node.Annotations = make(map[string]string, 2)
+		}
+		if node.Spec.Unschedulable && node.Annotations[maintenanceAnnotation] == "" {
+			node.Annotations[cordonedAnnotation] = "true"
+		}
+		node.Annotations[maintenanceAnnotation] = owner
+		node.Spec.Unschedulable = true
+	})
+}
+
+// uncordon marks the node schedulable again, unless another owner took over
+// its maintenance, or it was cordoned by someone else before.
+func (r *DaemonJobReconciler) uncordon(ctx context.Context, owner string, node *v1.Node) error {
+	return r.patchNode(ctx, node, func(node *v1.Node) {
+		if node.Annotations[maintenanceAnnotation] != owner {
+			return
+		}
+		if _, cordoned := node.Annotations[cordonedAnnotation]; !cordoned {
+			node.Spec.Unschedulable = false
+		}
+		delete(node.Annotations, maintenanceAnnotation)
+		delete(node.Annotations, cordonedAnnotation)
+	})
+}
+
+// tolerateUnschedulable lets the pods run on the cordoned nodes.
+func tolerateUnschedulable(podSpec *v1.PodSpec) {
+	tolerateTaint(podSpec, &v1.Taint{Key: v1.TaintNodeUnschedulable, Effect: v1.TaintEffectNoSchedule})
+}
+
+// indexPodNodeNameField indexes the pods by the name of their node.
+func indexPodNodeNameField(rawObj client.Object) []string {
+	pod := rawObj.(*v1.Pod)
+	if pod.Spec.NodeName == "" {
+		return nil
+	}
+	return []string{pod.Spec.NodeName}
+}
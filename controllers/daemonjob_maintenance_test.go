@@ -0,0 +1,65 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Maintenance", func() {
+
+	It("should cap the nodes in maintenance", func() {
+		maintenance := &daemonv1beta1.MaintenanceSpec{Cordon: true}
+		Expect(maxMaintenanceNodes(maintenance, 50)).To(Equal(daemonv1beta1.DefaultMaxMaintenanceNodes))
+
+		percent := intstr.FromString("25%")
+		maintenance.MaxConcurrentNodes = &percent
+		Expect(maxMaintenanceNodes(maintenance, 10)).To(Equal(3))
+	})
+
+	It("should tolerate the unschedulable nodes once", func() {
+		spec := &v1.PodSpec{
+			Tolerations: []v1.Toleration{{Key: "gpu", Operator: v1.TolerationOpExists}},
+		}
+		tolerateUnschedulable(spec)
+		Expect(spec.Tolerations).To(HaveLen(2))
+		Expect(spec.Tolerations[1].Key).To(Equal(v1.TaintNodeUnschedulable))
+
+		tolerateUnschedulable(spec)
+		Expect(spec.Tolerations).To(HaveLen(2))
+
+		spec = &v1.PodSpec{Tolerations: []v1.Toleration{{Operator: v1.TolerationOpExists}}}
+		tolerateUnschedulable(spec)
+		Expect(spec.Tolerations).To(HaveLen(1))
+	})
+
+	It("should find the pods using emptyDir volumes", func() {
+		pod := &v1.Pod{Spec: v1.PodSpec{Volumes: []v1.Volume{
+			{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}}},
+		}}}
+		Expect(usesEmptyDir(pod)).To(BeFalse())
+
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+		Expect(usesEmptyDir(pod)).To(BeTrue())
+	})
+})
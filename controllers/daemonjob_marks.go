@@ -0,0 +1,221 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// marksAnnotation records on a node the DaemonJobs that marked it, or
+	// removed its taints, as a comma separated list of owners.
+	marksAnnotation = "daemon.justk8s.com/marks"
+
+	eventReasonTaintsRemoved = "TaintsRemoved"
+)
+
+// marksNodes reports whether the DaemonJob labels or annotates the nodes
+// where it succeeded.
+func marksNodes(dj *daemonv1beta1.DaemonJob) bool {
+	return dj.Spec.OnSuccess != nil && (len(dj.Spec.OnSuccess.NodeLabels) > 0 || len(dj.Spec.OnSuccess.NodeAnnotations) > 0)
+}
+
+// patchesSucceededNodes reports whether the DaemonJob marks the nodes where
+// it succeeded, or removes their taints.
+func patchesSucceededNodes(dj *daemonv1beta1.DaemonJob) bool {
+	return marksNodes(dj) || (dj.Spec.OnSuccess != nil && len(dj.Spec.OnSuccess.RemoveTaints) > 0)
+}
+
+// reconcileNodeMarks sets the labels and annotations of spec.onSuccess on the
+// nodes where the DaemonJob succeeded, and removes them from the nodes that
+// failed since, or that the DaemonJob left. The taints of spec.onSuccess are
+// removed once, when a node gets marked. The marked nodes are recorded in the
+// node annotations, and reported in the status.
+func (r *DaemonJobReconciler) reconcileNodeMarks(ctx context.Context, dj *daemonv1beta1.DaemonJob, status *daemonv1beta1.DaemonJobStatus, nodeList *v1.NodeList) error {
+	log := clog.FromContext(ctx)
+
+	if !patchesSucceededNodes(dj) {
+		return nil
+	}
+	onSuccess := dj.Spec.OnSuccess
+	owner := nodeOwner(dj)
+
+	nodes := make(map[string]*v1.Node, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[nodeList.Items[i].Name] = &nodeList.Items[i]
+	}
+
+	// the nodes the DaemonJob left keep their marks until they are removed
+	current := make(map[string]bool, len(status.Nodes))
+	for _, nodeStatus := range status.Nodes {
+		current[nodeStatus.NodeName] = true
+	}
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if current[node.Name] || !hasNodeOwner(node, marksAnnotation, owner) || !r.NodeActions {
+			continue
+		}
+		if err := r.unmarkNode(ctx, onSuccess, owner, node); err != nil {
+			return err
+		}
+	}
+
+	var unmarked int
+	for i := range status.Nodes {
+		nodeStatus := &status.Nodes[i]
+		node := nodes[nodeStatus.NodeName]
+		if node == nil {
+			continue
+		}
+
+		switch nodeStatus.Phase {
+		case daemonv1beta1.NodeSucceeded:
+			if !r.NodeActions {
+				unmarked++
+				continue
+			}
+			// the marks removed from the node by hand are set again, but
+			// the taints added back are left in place
+			removeTaints := !nodeStatus.Marked && hasSelectedTaints(node, onSuccess.RemoveTaints)
+			if err := r.markNode(ctx, onSuccess, owner, node, removeTaints); err != nil {
+				return err
+			}
+			if !nodeStatus.Marked {
+				log.Info("marked node", "node", node.Name)
+			}
+			if removeTaints {
+				r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonTaintsRemoved, "Removed the taints of node %s", node.Name)
+			}
+			nodeStatus.Marked = true
+		case daemonv1beta1.NodeFailed:
+			if !nodeStatus.Marked || !r.NodeActions {
+				continue
+			}
+			if err := r.unmarkNode(ctx, onSuccess, owner, node); err != nil {
+				return err
+			}
+			nodeStatus.Marked = false
+
+			log.Info("unmarked failed node", "node", node.Name)
+		}
+	}
+
+	if unmarked > 0 {
+		r.Recorder.Eventf(dj, v1.EventTypeWarning, eventReasonNodeActionsDisabled,
+			"%d succeeded node(s) not patched, node actions are disabled in the operator", unmarked)
+	}
+
+	return nil
+}
+
+// unmarkAllNodes removes the labels and annotations of spec.onSuccess from
+// every node marked by a deleted DaemonJob.
+func (r *DaemonJobReconciler) unmarkAllNodes(ctx context.Context, dj *daemonv1beta1.DaemonJob, nodeList *v1.NodeList) error {
+	if !patchesSucceededNodes(dj) || !r.NodeActions {
+		return nil
+	}
+
+	owner := nodeOwner(dj)
+	for i := range nodeList.Items {
+		if !hasNodeOwner(&nodeList.Items[i], marksAnnotation, owner) {
+			continue
+		}
+		if err := r.unmarkNode(ctx, dj.Spec.OnSuccess, owner, &nodeList.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markNode sets the labels and annotations of spec.onSuccess on the node,
+// records the owner in its marks annotation, and removes its taints if
+// requested.
+func (r *DaemonJobReconciler) markNode(ctx context.Context, onSuccess *daemonv1beta1.OnSuccessSpec, owner string, node *v1.Node, removeTaints bool) error {
+	return r.patchNode(ctx, node, func(node *v1.Node) {
+		addNodeOwner(node, marksAnnotation, owner)
+		if removeTaints {
+			removeSelectedTaints(node, onSuccess.RemoveTaints)
+		}
+		if len(onSuccess.NodeLabels) > 0 && node.Labels == nil {
+			node.Labels = make(map[string]string, len(onSuccess.NodeLabels))
+		}
+		for k, v := range onSuccess.NodeLabels {
+			node.Labels[k] = v
+		}
+		if len(onSuccess.NodeAnnotations) > 0 && node.Annotations == nil {
+			node.Annotations = make(map[string]string, len(onSuccess.NodeAnnotations))
+		}
+		for k, v := range onSuccess.NodeAnnotations {
+			node.Annotations[k] = v
+		}
+	})
+}
+
+// unmarkNode removes the labels and annotations of spec.onSuccess from the
+// node, and the owner from its marks annotation. The ones changed since are
+// left in place.
+func (r *DaemonJobReconciler) unmarkNode(ctx context.Context, onSuccess *daemonv1beta1.OnSuccessSpec, owner string, node *v1.Node) error {
+	return r.patchNode(ctx, node, func(node *v1.Node) {
+		removeNodeOwner(node, marksAnnotation, owner)
+		for k, v := range onSuccess.NodeLabels {
+			if node.Labels[k] == v {
+				delete(node.Labels, k)
+			}
+		}
+		for k, v := range onSuccess.NodeAnnotations {
+			if node.Annotations[k] == v {
+				delete(node.Annotations, k)
+			}
+		}
+	})
+}
+
+// hasSelectedTaints reports whether the node has a taint selected by one of
+// the selectors.
+func hasSelectedTaints(node *v1.Node, selectors []daemonv1beta1.TaintSelector) bool {
+	for _, taint := range node.Spec.Taints {
+		if selectsTaint(selectors, taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSelectedTaints removes the taints selected by the selectors from the node.
+func removeSelectedTaints(node *v1.Node, selectors []daemonv1beta1.TaintSelector) {
+	var taints []v1.Taint
+	for _, taint := range node.Spec.Taints {
+		if !selectsTaint(selectors, taint) {
+			taints = append(taints, taint)
+		}
+	}
+	node.Spec.Taints = taints
+}
+
+func selectsTaint(selectors []daemonv1beta1.TaintSelector, taint v1.Taint) bool {
+	for _, selector := range selectors {
+		if selector.Key == taint.Key && (selector.Effect == "" || selector.Effect == taint.Effect) {
+			return true
+		}
+	}
+	return false
+}
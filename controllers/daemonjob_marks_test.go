@@ -0,0 +1,43 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Node marks", func() {
+
+	It("should remove the selected taints on success", func() {
+		node := &v1.Node{Spec: v1.NodeSpec{Taints: []v1.Taint{
+			{Key: "node.example.com/bootstrapping", Effect: v1.TaintEffectNoSchedule},
+			{Key: "node.example.com/bootstrapping", Effect: v1.TaintEffectNoExecute},
+			{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+		}}}
+		selectors := []daemonv1beta1.TaintSelector{{Key: "node.example.com/bootstrapping"}}
+		Expect(hasSelectedTaints(node, selectors)).To(BeTrue())
+
+		removeSelectedTaints(node, selectors)
+		Expect(node.Spec.Taints).To(ConsistOf(v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}))
+		Expect(hasSelectedTaints(node, selectors)).To(BeFalse())
+	})
+})
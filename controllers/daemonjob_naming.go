@@ -0,0 +1,76 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// jobName returns the name of the Job of a stage on a node:
+// <daemonjob>-<node>[-<stage>]. The job-name label of the pods must be a valid
+// label value, so a longer name is truncated and suffixed with the hash of the
+// full name, which keeps the names of different nodes apart.
+func jobName(daemonJobName, nodeName, stage string) string {
+	name := fmt.Sprintf("%s-%s", daemonJobName, nodeName)
+	if stage != mainStage {
+		name = fmt.Sprintf("%s-%s", name, stage)
+	}
+	if len(name) <= validation.DNS1123LabelMaxLength {
+		return name
+	}
+	return hashedName(name, name, validation.DNS1123LabelMaxLength)
+}
+
+// reportName returns the name of the NodeReport of a node:
+// <daemonjob>-<node>-<hash>. The hash of the DaemonJob and node names keeps
+// apart the pairs joined into the same name, e.g. a-b/c and a/b-c.
+func reportName(daemonJobName, nodeName string) string {
+	name := fmt.Sprintf("%s-%s", daemonJobName, nodeName)
+	return hashedName(name, daemonJobName+"/"+nodeName, validation.DNS1123SubdomainMaxLength)
+}
+
+// hashedName suffixes the name with the hash of the key, the name being
+// truncated to fit in maxLength.
+func hashedName(name, key string, maxLength int) string {
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(key))
+	hash := rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+
+	// the node part may end with a dot, which can not be followed by a dash
+	if len(name) > maxLength-len(hash)-1 {
+		name = strings.TrimRight(name[:maxLength-len(hash)-1], "-.")
+	}
+
+	return fmt.Sprintf("%s-%s", name, hash)
+}
+
+// jobLabels returns the labels of the Job of a node and of its pods, so that
+// they can be selected by DaemonJob and by node.
+func jobLabels(dj *daemonv1beta1.DaemonJob, nodeName, templateHash string) map[string]string {
+	return map[string]string{
+		daemonJobLabel:    labelValue(dj.Name),
+		daemonJobUIDLabel: string(dj.UID),
+		nodeNameLabel:     labelValue(nodeName),
+		templateHashLabel: templateHash,
+	}
+}
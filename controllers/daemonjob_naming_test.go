@@ -0,0 +1,60 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var _ = Describe("Job names", func() {
+
+	const (
+		daemonJobName = "kernel-inventory"
+		longNodeName  = "ip-10-0-1-23.eu-west-1.compute.internal"
+	)
+
+	It("should keep the short names", func() {
+		Expect(jobName(daemonJobName, "worker-1", mainStage)).To(Equal("kernel-inventory-worker-1"))
+		Expect(jobName(daemonJobName, "worker-1", checkStage)).To(Equal("kernel-inventory-worker-1-check"))
+	})
+
+	It("should truncate and hash the long names", func() {
+		names := map[string]bool{}
+		for _, nodeName := range []string{longNodeName, "ip-10-0-1-24.eu-west-1.compute.internal"} {
+			for _, stage := range []string{mainStage, checkStage, verifyStage} {
+				name := jobName(daemonJobName, nodeName, stage)
+				Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty())
+				Expect(validation.IsValidLabelValue(name)).To(BeEmpty())
+				names[name] = true
+			}
+		}
+		Expect(names).To(HaveLen(6))
+	})
+
+	It("should keep the report names of different nodes apart", func() {
+		Expect(reportName("a-b", "c")).NotTo(Equal(reportName("a", "b-c")))
+		Expect(reportName(daemonJobName, "worker-1")).To(HavePrefix("kernel-inventory-worker-1-"))
+
+		name := reportName(daemonJobName, strings.Repeat("a", validation.DNS1123SubdomainMaxLength))
+		Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty())
+	})
+})
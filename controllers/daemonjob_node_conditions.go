@@ -0,0 +1,109 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// scaleDownCandidateTaint is set by the cluster autoscaler on the nodes it
+// is about to remove.
+const scaleDownCandidateTaint = "ToBeDeletedByClusterAutoscaler"
+
+// policyRank orders the policies of spec.nodeConditions, the strictest last.
+var policyRank = map[daemonv1beta1.NodeConditionPolicy]int{
+	daemonv1beta1.NodeConditionRun:  0,
+	daemonv1beta1.NodeConditionWait: 1,
+	daemonv1beta1.NodeConditionSkip: 2,
+}
+
+// nodeCondition returns the condition of the node with the strictest policy
+// of spec.nodeConditions, along with the policy. The nodes cordoned by the
+// maintenance of the DaemonJob are not unschedulable for it.
+func nodeCondition(dj *daemonv1beta1.DaemonJob, node *v1.Node) (string, daemonv1beta1.NodeConditionPolicy) {
+	conditions := dj.Spec.NodeConditions
+	if conditions == nil {
+		return "", daemonv1beta1.NodeConditionRun
+	}
+
+	condition, policy := "", daemonv1beta1.NodeConditionRun
+	match := func(c string, p daemonv1beta1.NodeConditionPolicy) {
+		if policyRank[p] > policyRank[policy] {
+			condition, policy = c, p
+		}
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == scaleDownCandidateTaint {
+			match("a scale-down candidate", conditions.ScaleDownCandidate)
+		}
+	}
+	if !nodeReady(node) {
+		match("NotReady", conditions.NotReady)
+	}
+	if node.Spec.Unschedulable && node.Annotations[maintenanceAnnotation] != nodeOwner(dj) {
+		match("unschedulable", conditions.Unschedulable)
+	}
+
+	return condition, policy
+}
+
+// skipsNode reports whether the node is left out of the DaemonJob by
+// spec.nodeConditions: no job has been created on it yet.
+func skipsNode(dj *daemonv1beta1.DaemonJob, node *v1.Node, jobs nodeJobs) bool {
+	if len(jobs) > 0 {
+		return false
+	}
+	_, policy := nodeCondition(dj, node)
+	return policy == daemonv1beta1.NodeConditionSkip
+}
+
+// skippedReason returns why a node in the given condition is skipped.
+func skippedReason(condition string) string {
+	return "skipped, node is " + condition
+}
+
+// nodeConditionHolds holds back the nodes whose condition keeps them from
+// running their next job. A skipped node that started its jobs already waits
+// instead.
+func (r *DaemonJobReconciler) nodeConditionHolds(dj *daemonv1beta1.DaemonJob, nodeList *v1.NodeList, jobs map[string]nodeJobs, holds map[string]string) {
+	if dj.Spec.NodeConditions == nil {
+		return
+	}
+
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if shouldRun, _ := r.nodeShouldRunDaemonJob(node, dj); !shouldRun {
+			continue
+		}
+		if _, held := holds[node.Name]; held {
+			continue
+		}
+		if _, next := nodeProgress(dj, node.Name, jobs[node.Name]); next == nil {
+			continue
+		}
+
+		condition, policy := nodeCondition(dj, node)
+		switch {
+		case policy == daemonv1beta1.NodeConditionRun:
+		case skipsNode(dj, node, jobs[node.Name]):
+			holds[node.Name] = skippedReason(condition)
+		default:
+			holds[node.Name] = "waiting, node is " + condition
+		}
+	}
+}
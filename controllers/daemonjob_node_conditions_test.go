@@ -0,0 +1,93 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Node conditions", func() {
+	var dj *daemonv1beta1.DaemonJob
+	var node *v1.Node
+
+	BeforeEach(func() {
+		dj = &daemonv1beta1.DaemonJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "patch", Namespace: "default"},
+			Spec: daemonv1beta1.DaemonJobSpec{
+				NodeConditions: &daemonv1beta1.NodeConditionsSpec{
+					NotReady:      daemonv1beta1.NodeConditionWait,
+					Unschedulable: daemonv1beta1.NodeConditionSkip,
+				},
+			},
+		}
+		node = &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-0"},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+			},
+		}
+	})
+
+	It("should run the jobs on the healthy nodes", func() {
+		condition, policy := nodeCondition(dj, node)
+		Expect(condition).To(BeEmpty())
+		Expect(policy).To(Equal(daemonv1beta1.NodeConditionRun))
+	})
+
+	It("should run the jobs on every node without policies", func() {
+		dj.Spec.NodeConditions = nil
+		node.Status.Conditions = nil
+		_, policy := nodeCondition(dj, node)
+		Expect(policy).To(Equal(daemonv1beta1.NodeConditionRun))
+	})
+
+	It("should apply the strictest policy of the node conditions", func() {
+		node.Status.Conditions[0].Status = v1.ConditionUnknown
+		condition, policy := nodeCondition(dj, node)
+		Expect(condition).To(Equal("NotReady"))
+		Expect(policy).To(Equal(daemonv1beta1.NodeConditionWait))
+
+		node.Spec.Unschedulable = true
+		condition, policy = nodeCondition(dj, node)
+		Expect(condition).To(Equal("unschedulable"))
+		Expect(policy).To(Equal(daemonv1beta1.NodeConditionSkip))
+
+		node.Spec.Taints = []v1.Taint{{Key: scaleDownCandidateTaint, Effect: v1.TaintEffectNoSchedule}}
+		condition, _ = nodeCondition(dj, node)
+		Expect(condition).To(Equal("unschedulable"))
+	})
+
+	It("should not skip the nodes cordoned by the maintenance of the DaemonJob", func() {
+		node.Spec.Unschedulable = true
+		node.Annotations = map[string]string{maintenanceAnnotation: "default/patch"}
+		_, policy := nodeCondition(dj, node)
+		Expect(policy).To(Equal(daemonv1beta1.NodeConditionRun))
+	})
+
+	It("should only skip the nodes without jobs", func() {
+		node.Spec.Unschedulable = true
+		Expect(skipsNode(dj, node, nil)).To(BeTrue())
+		Expect(skipsNode(dj, node, nodeJobs{mainStage: &batchv1.Job{}})).To(BeFalse())
+	})
+})
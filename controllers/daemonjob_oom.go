@@ -0,0 +1,206 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// oomKilledReason is the reason of a container terminated by the OOM killer
+	oomKilledReason = "OOMKilled"
+
+	eventReasonOOMRetry = "OOMRetry"
+)
+
+// memoryBumps returns the number of times the memory of the jobs of the node
+// has been scaled up, as recorded in the status.
+func memoryBumps(dj *daemonv1beta1.DaemonJob, nodeName string) int32 {
+	for _, nodeStatus := range dj.Status.Nodes {
+		if nodeStatus.NodeName == nodeName {
+			return nodeStatus.MemoryBumps
+		}
+	}
+	return 0
+}
+
+// scalesMemory reports whether the memory of the jobs of the given stage is
+// scaled up by the OOM kills: only the jobTemplate and the steps are, the
+// other stages keep the memory of their template.
+func scalesMemory(stage string) bool {
+	return fixesNode(stage)
+}
+
+// scaleMemory multiplies the memory requests and limits of the containers by
+// the factor of the OOM retry, once per bump, without going beyond its
+// maxMemory. The memory already beyond maxMemory is left as is.
+func scaleMemory(podSpec *v1.PodSpec, oomRetry *daemonv1beta1.OOMRetry, bumps int32) {
+	if bumps == 0 {
+		return
+	}
+
+	scale := func(resources v1.ResourceList) {
+		memory, ok := resources[v1.ResourceMemory]
+		if !ok || memory.Cmp(oomRetry.MaxMemory) >= 0 {
+			return
+		}
+		resources[v1.ResourceMemory] = scaledMemory(memory, oomRetry, bumps)
+	}
+	for i := range podSpec.InitContainers {
+		scale(podSpec.InitContainers[i].Resources.Requests)
+		scale(podSpec.InitContainers[i].Resources.Limits)
+	}
+	for i := range podSpec.Containers {
+		scale(podSpec.Containers[i].Resources.Requests)
+		scale(podSpec.Containers[i].Resources.Limits)
+	}
+}
+
+// scaledMemory returns the memory multiplied by the factor of the OOM retry
+// the given number of times, capped at its maxMemory.
+func scaledMemory(memory resource.Quantity, oomRetry *daemonv1beta1.OOMRetry, bumps int32) resource.Quantity {
+	factor := daemonv1beta1.DefaultOOMRetryFactor
+	if oomRetry.Factor != nil {
+		factor = *oomRetry.Factor
+	}
+	maxMemory := oomRetry.MaxMemory.Value()
+
+	value := memory.Value()
+	for i := int32(0); i < bumps && value < maxMemory; i++ {
+		value = value * factor.MilliValue() / 1000
+	}
+	if value > maxMemory {
+		value = maxMemory
+	}
+
+	return *resource.NewQuantity(value, memory.Format)
+}
+
+// oomKilled reports whether a container of the pods was OOMKilled.
+func oomKilled(pods []v1.Pod) bool {
+	killed := func(statuses []v1.ContainerStatus) bool {
+		for _, status := range statuses {
+			// a container restarted by its pod keeps the OOM kill as its last state
+			for _, state := range []v1.ContainerState{status.State, status.LastTerminationState} {
+				if state.Terminated != nil && state.Terminated.Reason == oomKilledReason {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, pod := range pods {
+		if killed(pod.Status.InitContainerStatuses) || killed(pod.Status.ContainerStatuses) {
+			return true
+		}
+	}
+	return false
+}
+
+// bumpOOMKilledNodes deletes the failed Jobs whose containers were OOMKilled,
+// so that they are created again with more memory, and removes them from the
+// child Jobs. The bumps are counted in the status of the nodes, updated before
+// the Jobs are deleted, the later Jobs of these nodes keep the bumped memory.
+// A Job whose memory can not grow any more is left failed.
+func (r *DaemonJobReconciler) bumpOOMKilledNodes(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList) error {
+	log := clog.FromContext(ctx)
+
+	oomRetry := dj.Spec.OOMRetry
+	if oomRetry == nil {
+		return nil
+	}
+
+	jobs := jobsByNode(childJobs)
+	var bumps []*batchv1.Job
+	for i := range dj.Status.Nodes {
+		nodeStatus := &dj.Status.Nodes[i]
+		job, _ := failedJob(jobs[nodeStatus.NodeName])
+		if job == nil {
+			continue
+		}
+		// the onFailure job finishes before the node runs again
+		if status, _ := nodeProgress(dj, nodeStatus.NodeName, jobs[nodeStatus.NodeName]); status.OnFailure == daemonv1beta1.NodePending || status.OnFailure == daemonv1beta1.NodeRunning {
+			continue
+		}
+
+		// the job would be created again as is
+		stage := job.Annotations[stageAnnotation]
+		if !scalesMemory(stage) {
+			continue
+		}
+		podSpec := stageTemplate(dj, stage).Spec.Template.Spec
+		current, next := podSpec.DeepCopy(), podSpec.DeepCopy()
+		scaleMemory(current, oomRetry, nodeStatus.MemoryBumps)
+		scaleMemory(next, oomRetry, nodeStatus.MemoryBumps+1)
+		if equality.Semantic.DeepEqual(current, next) {
+			continue
+		}
+
+		var pods v1.PodList
+		if err := r.List(ctx, &pods,
+			client.InNamespace(job.Namespace),
+			client.MatchingLabels{"controller-uid": string(job.UID)}); err != nil {
+			return err
+		}
+		if !oomKilled(pods.Items) {
+			continue
+		}
+
+		nodeStatus.MemoryBumps++
+		bumps = append(bumps, job)
+	}
+	if len(bumps) == 0 {
+		return nil
+	}
+
+	// the bumps are counted before the Jobs are deleted, the Jobs created
+	// again would not get their memory otherwise
+	if err := r.Status().Update(ctx, dj); err != nil {
+		return err
+	}
+
+	bumped := make(map[string]bool)
+	for _, job := range bumps {
+		nodeName := job.Annotations[annotation]
+		if err := r.deleteFailedJob(ctx, job, jobs[nodeName], bumped); err != nil {
+			return err
+		}
+
+		log.Info("scaling up the memory of OOMKilled node", "node", nodeName, "bumps", memoryBumps(dj, nodeName))
+		r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonOOMRetry, "Job %s was OOMKilled on node %s, scaling up its memory",
+			job.Name, nodeName)
+	}
+
+	kept := childJobs.Items[:0]
+	for _, job := range childJobs.Items {
+		if !bumped[job.Name] {
+			kept = append(kept, job)
+		}
+	}
+	childJobs.Items = kept
+
+	return nil
+}
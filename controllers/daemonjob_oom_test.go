@@ -0,0 +1,90 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("OOM retries", func() {
+
+	factor := resource.MustParse("1.5")
+	oomRetry := &daemonv1beta1.OOMRetry{Factor: &factor, MaxMemory: resource.MustParse("1Gi")}
+
+	podSpec := func(request, limit string) *v1.PodSpec {
+		return &v1.PodSpec{Containers: []v1.Container{{
+			Name: "inventory",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse(request)},
+				Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse(limit)},
+			},
+		}}}
+	}
+	memory := func(podSpec *v1.PodSpec) (int64, int64) {
+		resources := podSpec.Containers[0].Resources
+		return resources.Requests.Memory().Value(), resources.Limits.Memory().Value()
+	}
+
+	It("should scale up the memory once per bump", func() {
+		spec := podSpec("128Mi", "256Mi")
+		scaleMemory(spec, oomRetry, 2)
+
+		request, limit := memory(spec)
+		Expect(request).To(Equal(int64(288 * 1024 * 1024)))
+		Expect(limit).To(Equal(int64(576 * 1024 * 1024)))
+	})
+
+	It("should cap the memory", func() {
+		spec := podSpec("512Mi", "2Gi")
+		scaleMemory(spec, oomRetry, 5)
+
+		request, limit := memory(spec)
+		Expect(request).To(Equal(oomRetry.MaxMemory.Value()))
+		Expect(limit).To(Equal(int64(2 * 1024 * 1024 * 1024)))
+	})
+
+	It("should only scale up the memory of the jobTemplate and the steps", func() {
+		Expect(scalesMemory(mainStage)).To(BeTrue())
+		Expect(scalesMemory("install")).To(BeTrue())
+		for _, stage := range []string{checkStage, verifyStage, teardownStage, onFailureStage, rebootStage} {
+			Expect(scalesMemory(stage)).To(BeFalse())
+		}
+	})
+
+	It("should leave the containers without memory alone", func() {
+		spec := &v1.PodSpec{Containers: []v1.Container{{Name: "inventory"}}}
+		scaleMemory(spec, oomRetry, 1)
+		Expect(spec.Containers[0].Resources.Limits).To(BeNil())
+	})
+
+	It("should find the containers restarted after an OOM kill", func() {
+		pod := v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name: "inventory",
+			LastTerminationState: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{Reason: oomKilledReason, ExitCode: 137},
+			},
+		}}}}
+		Expect(oomKilled([]v1.Pod{pod})).To(BeTrue())
+		Expect(oomKilled([]v1.Pod{{}})).To(BeFalse())
+	})
+})
@@ -0,0 +1,221 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+const (
+	// mainStage runs the jobTemplate of the DaemonJob. With spec.steps, each
+	// step runs as a stage named after the step instead.
+	mainStage = ""
+	// checkStage runs the checkTemplate before the jobTemplate
+	checkStage = "check"
+	// verifyStage runs the checkTemplate again after the jobTemplate
+	verifyStage = "verify"
+	// teardownStage runs the teardownTemplate when the DaemonJob is deleted
+	teardownStage = "teardown"
+	// onFailureStage runs the onFailure jobTemplate once the node failed
+	onFailureStage = "on-failure"
+	// rebootStage runs the reboot jobTemplate on a node whose job requested it
+	rebootStage = "reboot"
+)
+
+// nodeJobs are the child Jobs of a node, by stage
+type nodeJobs map[string]*batchv1.Job
+
+// jobsByNode groups the child Jobs by node and stage. Jobs without a node
+// annotation are grouped by their own name.
+func jobsByNode(childJobs *batchv1.JobList) map[string]nodeJobs {
+	nodes := make(map[string]nodeJobs)
+
+	for i := range childJobs.Items {
+		job := &childJobs.Items[i]
+
+		nodeName, ok := job.Annotations[annotation]
+		if !ok {
+			nodeName = job.Name
+		}
+		if nodes[nodeName] == nil {
+			nodes[nodeName] = make(nodeJobs)
+		}
+		nodes[nodeName][job.Annotations[stageAnnotation]] = job
+	}
+
+	return nodes
+}
+
+// fixesNode reports whether the given stage runs the jobTemplate or one of the
+// steps, rather than the check, teardown, onFailure or reboot job.
+func fixesNode(stage string) bool {
+	switch stage {
+	case checkStage, verifyStage, teardownStage, onFailureStage, rebootStage:
+		return false
+	}
+	return true
+}
+
+// stageTemplate returns the job template run by the given stage.
+func stageTemplate(dj *daemonv1beta1.DaemonJob, stage string) *daemonv1beta1.JobTemplateSpec {
+	switch stage {
+	case checkStage, verifyStage:
+		return dj.Spec.CheckTemplate
+	case teardownStage:
+		return dj.Spec.TeardownTemplate
+	case onFailureStage:
+		return dj.Spec.OnFailure.JobTemplate
+	case rebootStage:
+		return &dj.Spec.Reboot.JobTemplate
+	}
+
+	for i := range dj.Spec.Steps {
+		if dj.Spec.Steps[i].Name == stage {
+			return &dj.Spec.Steps[i].JobTemplate
+		}
+	}
+
+	return &dj.Spec.JobTemplate
+}
+
+// reportStage returns the stage whose output is collected into NodeReports,
+// the last step if spec.steps is set.
+func reportStage(dj *daemonv1beta1.DaemonJob) string {
+	if len(dj.Spec.Steps) > 0 {
+		return dj.Spec.Steps[len(dj.Spec.Steps)-1].Name
+	}
+
+	return mainStage
+}
+
+// nodeProgress returns the status of the DaemonJob on a node from the Jobs
+// already created on it, and the stage whose Job should be created next, if any.
+func nodeProgress(dj *daemonv1beta1.DaemonJob, nodeName string, jobs nodeJobs) (status daemonv1beta1.NodeStatus, next *string) {
+	if dj.Spec.CheckTemplate != nil {
+		status, next = checkedNodeProgress(dj, nodeName, jobs)
+	} else {
+		status = daemonv1beta1.NodeStatus{NodeName: nodeName}
+		status.Phase, status.Step, next = runProgress(dj, jobs)
+	}
+
+	// the onFailure job runs on the failed node
+	if status.Phase == daemonv1beta1.NodeFailed && hasOnFailureJob(dj) {
+		status.OnFailure, next = stageProgress(jobs, onFailureStage)
+	}
+
+	return status, next
+}
+
+// hasOnFailureJob reports whether a job runs on the nodes that failed.
+func hasOnFailureJob(dj *daemonv1beta1.DaemonJob) bool {
+	return dj.Spec.OnFailure != nil && dj.Spec.OnFailure.JobTemplate != nil
+}
+
+// checkedNodeProgress runs the check stage, then the main stage if the check
+// failed, and the verify stage after the main stage if requested.
+func checkedNodeProgress(dj *daemonv1beta1.DaemonJob, nodeName string, jobs nodeJobs) (daemonv1beta1.NodeStatus, *string) {
+	status := daemonv1beta1.NodeStatus{NodeName: nodeName}
+
+	phase, next := stageProgress(jobs, checkStage)
+	switch phase {
+	case daemonv1beta1.NodeSucceeded:
+		status.Phase = daemonv1beta1.NodeSucceeded
+		status.Compliance = daemonv1beta1.NodeCompliant
+		return status, nil
+	case daemonv1beta1.NodeFailed:
+		// the node has to be remediated
+	default:
+		status.Phase = phase
+		return status, next
+	}
+
+	phase, status.Step, next = runProgress(dj, jobs)
+	switch phase {
+	case daemonv1beta1.NodeSucceeded:
+		// the node has been remediated
+	case daemonv1beta1.NodeFailed:
+		status.Phase = daemonv1beta1.NodeFailed
+		status.Compliance = daemonv1beta1.NodeNonCompliant
+		return status, nil
+	default:
+		// the check has run, the fix is pending or running
+		status.Phase = daemonv1beta1.NodeRunning
+		return status, next
+	}
+
+	if dj.Spec.VerifyAfterFix {
+		phase, next = stageProgress(jobs, verifyStage)
+		switch phase {
+		case daemonv1beta1.NodeSucceeded:
+			// the remediation has been verified
+		case daemonv1beta1.NodeFailed:
+			status.Phase = daemonv1beta1.NodeFailed
+			status.Compliance = daemonv1beta1.NodeNonCompliant
+			return status, nil
+		default:
+			status.Phase = daemonv1beta1.NodeRunning
+			return status, next
+		}
+	}
+
+	status.Phase = daemonv1beta1.NodeSucceeded
+	status.Compliance = daemonv1beta1.NodeRemediated
+	return status, nil
+}
+
+// runProgress returns the phase of the main stage, or of the steps if
+// spec.steps is set, along with the current step and the stage to create next.
+func runProgress(dj *daemonv1beta1.DaemonJob, jobs nodeJobs) (daemonv1beta1.NodePhase, string, *string) {
+	if len(dj.Spec.Steps) == 0 {
+		phase, next := stageProgress(jobs, mainStage)
+		return phase, "", next
+	}
+
+	for i, step := range dj.Spec.Steps {
+		phase, next := stageProgress(jobs, step.Name)
+		if phase == daemonv1beta1.NodeSucceeded {
+			continue
+		}
+		if phase == daemonv1beta1.NodePending && i > 0 {
+			// the previous steps completed
+			phase = daemonv1beta1.NodeRunning
+		}
+
+		return phase, step.Name, next
+	}
+
+	return daemonv1beta1.NodeSucceeded, dj.Spec.Steps[len(dj.Spec.Steps)-1].Name, nil
+}
+
+// stageProgress returns the phase of the Job of the given stage, and the stage
+// itself if its Job has not been created yet.
+func stageProgress(jobs nodeJobs, stage string) (daemonv1beta1.NodePhase, *string) {
+	job, ok := jobs[stage]
+	if !ok {
+		return daemonv1beta1.NodePending, &stage
+	}
+
+	switch jobStatus(*job) {
+	case batchv1.JobComplete:
+		return daemonv1beta1.NodeSucceeded, nil
+	case batchv1.JobFailed:
+		return daemonv1beta1.NodeFailed, nil
+	default:
+		return daemonv1beta1.NodeRunning, nil
+	}
+}
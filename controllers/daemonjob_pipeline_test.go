@@ -0,0 +1,168 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Check-then-fix", func() {
+
+	dj := &daemonv1beta1.DaemonJob{
+		Spec: daemonv1beta1.DaemonJobSpec{
+			CheckTemplate: &daemonv1beta1.JobTemplateSpec{},
+		},
+	}
+
+	job := func(condition batchv1.JobConditionType) *batchv1.Job {
+		job := &batchv1.Job{}
+		if condition != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: v1.ConditionTrue}}
+		}
+		return job
+	}
+
+	It("should run the check first", func() {
+		status, next := nodeProgress(dj, "node-a", nil)
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodePending))
+		Expect(next).NotTo(BeNil())
+		Expect(*next).To(Equal(checkStage))
+	})
+
+	It("should not run the jobTemplate on a compliant node", func() {
+		status, next := nodeProgress(dj, "node-a", nodeJobs{checkStage: job(batchv1.JobComplete)})
+		Expect(next).To(BeNil())
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeSucceeded))
+		Expect(status.Compliance).To(Equal(daemonv1beta1.NodeCompliant))
+	})
+
+	It("should run the jobTemplate when the check failed", func() {
+		status, next := nodeProgress(dj, "node-a", nodeJobs{checkStage: job(batchv1.JobFailed)})
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeRunning))
+		Expect(next).NotTo(BeNil())
+		Expect(*next).To(Equal(mainStage))
+
+		status, next = nodeProgress(dj, "node-a", nodeJobs{
+			checkStage: job(batchv1.JobFailed),
+			mainStage:  job(batchv1.JobComplete),
+		})
+		Expect(next).To(BeNil())
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeSucceeded))
+		Expect(status.Compliance).To(Equal(daemonv1beta1.NodeRemediated))
+	})
+
+	It("should verify the remediation when requested", func() {
+		verified := dj.DeepCopy()
+		verified.Spec.VerifyAfterFix = true
+		jobs := nodeJobs{
+			checkStage: job(batchv1.JobFailed),
+			mainStage:  job(batchv1.JobComplete),
+		}
+
+		_, next := nodeProgress(verified, "node-a", jobs)
+		Expect(next).NotTo(BeNil())
+		Expect(*next).To(Equal(verifyStage))
+
+		jobs[verifyStage] = job(batchv1.JobFailed)
+		status, next := nodeProgress(verified, "node-a", jobs)
+		Expect(next).To(BeNil())
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeFailed))
+		Expect(status.Compliance).To(Equal(daemonv1beta1.NodeNonCompliant))
+	})
+
+	It("should run the steps one after another", func() {
+		steps := &daemonv1beta1.DaemonJob{
+			Spec: daemonv1beta1.DaemonJobSpec{
+				Steps: []daemonv1beta1.StepSpec{{Name: "pre-check"}, {Name: "apply"}},
+			},
+		}
+
+		status, next := nodeProgress(steps, "node-a", nil)
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodePending))
+		Expect(status.Step).To(Equal("pre-check"))
+		Expect(*next).To(Equal("pre-check"))
+
+		status, next = nodeProgress(steps, "node-a", nodeJobs{"pre-check": job(batchv1.JobComplete)})
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeRunning))
+		Expect(status.Step).To(Equal("apply"))
+		Expect(*next).To(Equal("apply"))
+
+		status, next = nodeProgress(steps, "node-a", nodeJobs{
+			"pre-check": job(batchv1.JobComplete),
+			"apply":     job(batchv1.JobComplete),
+		})
+		Expect(next).To(BeNil())
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeSucceeded))
+		Expect(status.Step).To(Equal("apply"))
+		Expect(stageTemplate(steps, "apply")).To(BeIdenticalTo(&steps.Spec.Steps[1].JobTemplate))
+	})
+
+	It("should stop at a failed step", func() {
+		steps := &daemonv1beta1.DaemonJob{
+			Spec: daemonv1beta1.DaemonJobSpec{
+				Steps: []daemonv1beta1.StepSpec{{Name: "pre-check"}, {Name: "apply"}},
+			},
+		}
+
+		status, next := nodeProgress(steps, "node-a", nodeJobs{"pre-check": job(batchv1.JobFailed)})
+		Expect(next).To(BeNil())
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeFailed))
+		Expect(status.Step).To(Equal("pre-check"))
+	})
+
+	It("should not retry the check jobs", func() {
+		Expect(*newJob("default", dj, "node-a", checkStage).Spec.BackoffLimit).To(BeZero())
+		Expect(*newJob("default", dj, "node-a", verifyStage).Spec.BackoffLimit).To(BeZero())
+
+		backoffLimit := int32(2)
+		checked := dj.DeepCopy()
+		checked.Spec.CheckTemplate.Spec.BackoffLimit = &backoffLimit
+		Expect(*newJob("default", checked, "node-a", checkStage).Spec.BackoffLimit).To(Equal(backoffLimit))
+	})
+
+	It("should run the onFailure job on a failed node", func() {
+		onFailure := &daemonv1beta1.DaemonJob{
+			Spec: daemonv1beta1.DaemonJobSpec{
+				OnFailure: &daemonv1beta1.OnFailureSpec{JobTemplate: &daemonv1beta1.JobTemplateSpec{}},
+			},
+		}
+
+		status, next := nodeProgress(onFailure, "node-a", nodeJobs{mainStage: job(batchv1.JobComplete)})
+		Expect(next).To(BeNil())
+		Expect(status.OnFailure).To(BeEmpty())
+
+		status, next = nodeProgress(onFailure, "node-a", nodeJobs{mainStage: job(batchv1.JobFailed)})
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeFailed))
+		Expect(status.OnFailure).To(Equal(daemonv1beta1.NodePending))
+		Expect(next).NotTo(BeNil())
+		Expect(*next).To(Equal(onFailureStage))
+
+		status, next = nodeProgress(onFailure, "node-a", nodeJobs{
+			mainStage:      job(batchv1.JobFailed),
+			onFailureStage: job(batchv1.JobComplete),
+		})
+		Expect(next).To(BeNil())
+		Expect(status.Phase).To(Equal(daemonv1beta1.NodeFailed))
+		Expect(status.OnFailure).To(Equal(daemonv1beta1.NodeSucceeded))
+	})
+})
@@ -0,0 +1,335 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// quarantineAnnotation records on a node the DaemonJobs that quarantined
+	// it, as a comma separated list of owners.
+	quarantineAnnotation = "daemon.justk8s.com/quarantine"
+
+	eventReasonQuarantine          = "Quarantine"
+	eventReasonQuarantineLifted    = "QuarantineLifted"
+	eventReasonQuarantineCapped    = "QuarantineCapped"
+	eventReasonNodeActionsDisabled = "NodeActionsDisabled"
+)
+
+// quarantineAction returns the action quarantining the failed nodes, if any.
+func quarantineAction(dj *daemonv1beta1.DaemonJob) *daemonv1beta1.NodeAction {
+	if dj.Spec.OnFailure == nil {
+		return nil
+	}
+	return dj.Spec.OnFailure.NodeAction
+}
+
+// maxQuarantinedNodes returns how many of the nodes of the DaemonJob may be
+// quarantined at once, a percentage being rounded up.
+func maxQuarantinedNodes(action *daemonv1beta1.NodeAction, nodes int) int {
+	if action.MaxQuarantinedNodes == nil {
+		return daemonv1beta1.DefaultMaxQuarantinedNodes
+	}
+	maxNodes, err := intstr.GetScaledValueFromIntOrPercent(action.MaxQuarantinedNodes, nodes, true)
+	if err != nil {
+		return daemonv1beta1.DefaultMaxQuarantinedNodes
+	}
+	return maxNodes
+}
+
+// reconcileQuarantine quarantines the failed nodes, up to the cap of the
+// nodeAction, and lifts the quarantine of the nodes that succeeded since, or
+// that the DaemonJob left. The quarantined nodes are recorded in the node
+// annotations, and reported in the status.
+func (r *DaemonJobReconciler) reconcileQuarantine(ctx context.Context, dj *daemonv1beta1.DaemonJob, status *daemonv1beta1.DaemonJobStatus, nodeList *v1.NodeList) error {
+	log := clog.FromContext(ctx)
+
+	action := quarantineAction(dj)
+	if action == nil {
+		return nil
+	}
+
+	owner := nodeOwner(dj)
+
+	nodes := make(map[string]*v1.Node, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[nodeList.Items[i].Name] = &nodeList.Items[i]
+	}
+
+	// the nodes the DaemonJob left keep their quarantine until they are lifted
+	current := make(map[string]bool, len(status.Nodes))
+	for _, nodeStatus := range status.Nodes {
+		current[nodeStatus.NodeName] = true
+	}
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if current[node.Name] || !hasNodeOwner(node, quarantineAnnotation, owner) {
+			continue
+		}
+		if !r.NodeActions {
+			return nil
+		}
+		if err := r.liftQuarantine(ctx, action, owner, node); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonQuarantineLifted, "Lifted the quarantine of node %s", node.Name)
+	}
+
+	var quarantined int
+	var failed []*daemonv1beta1.NodeStatus
+	for i := range status.Nodes {
+		nodeStatus := &status.Nodes[i]
+		node := nodes[nodeStatus.NodeName]
+		switch {
+		case !nodeStatus.Quarantined && nodeStatus.Phase == daemonv1beta1.NodeFailed:
+			failed = append(failed, nodeStatus)
+		case nodeStatus.Quarantined && nodeStatus.Phase == daemonv1beta1.NodeSucceeded:
+			if !r.NodeActions {
+				continue
+			}
+			if err := r.liftQuarantine(ctx, action, owner, node); err != nil {
+				return err
+			}
+			nodeStatus.Quarantined = false
+
+			log.Info("lifted the quarantine of node", "node", node.Name)
+			r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonQuarantineLifted, "Lifted the quarantine of node %s", node.Name)
+		case nodeStatus.Quarantined:
+			quarantined++
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	if !r.NodeActions {
+		r.Recorder.Eventf(dj, v1.EventTypeWarning, eventReasonNodeActionsDisabled,
+			"%d failed node(s) not quarantined, node actions are disabled in the operator", len(failed))
+		return nil
+	}
+
+	maxNodes := maxQuarantinedNodes(action, len(status.Nodes))
+	for i, nodeStatus := range failed {
+		if quarantined >= maxNodes {
+			r.Recorder.Eventf(dj, v1.EventTypeWarning, eventReasonQuarantineCapped,
+				"%d failed node(s) not quarantined, at most %d node(s) are quarantined at once", len(failed)-i, maxNodes)
+			break
+		}
+		node := nodes[nodeStatus.NodeName]
+		if node == nil {
+			continue
+		}
+		if err := r.quarantine(ctx, action, owner, node); err != nil {
+			return err
+		}
+		nodeStatus.Quarantined = true
+		quarantined++
+
+		log.Info("quarantined node", "node", node.Name)
+		r.Recorder.Eventf(dj, v1.EventTypeWarning, eventReasonQuarantine, "Quarantined node %s, its Job failed", node.Name)
+	}
+
+	return nil
+}
+
+// liftAllQuarantines lifts the quarantine of every node of a deleted DaemonJob.
+func (r *DaemonJobReconciler) liftAllQuarantines(ctx context.Context, dj *daemonv1beta1.DaemonJob, nodeList *v1.NodeList) error {
+	action := quarantineAction(dj)
+	if action == nil || !r.NodeActions {
+		return nil
+	}
+
+	owner := nodeOwner(dj)
+	for i := range nodeList.Items {
+		if !hasNodeOwner(&nodeList.Items[i], quarantineAnnotation, owner) {
+			continue
+		}
+		if err := r.liftQuarantine(ctx, action, owner, &nodeList.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// quarantine adds the taint and labels of the action to the node, and records
+// the owner in its quarantine annotation.
+func (r *DaemonJobReconciler) quarantine(ctx context.Context, action *daemonv1beta1.NodeAction, owner string, node *v1.Node) error {
+	return r.patchNode(ctx, node, func(node *v1.Node) {
+		addNodeOwner(node, quarantineAnnotation, owner)
+		if taint := action.Taint; taint != nil && !hasTaint(node, taint) {
+			node.Spec.Taints = append(node.Spec.Taints, *taint)
+		}
+		if len(action.Labels) > 0 && node.Labels == nil {
+			node.Labels = make(map[string]string, len(action.Labels))
+		}
+		for k, v := range action.Labels {
+			node.Labels[k] = v
+		}
+	})
+}
+
+// liftQuarantine removes the taint and labels of the action from the node,
+// and the owner from its quarantine annotation. The labels changed since are
+// left in place.
+func (r *DaemonJobReconciler) liftQuarantine(ctx context.Context, action *daemonv1beta1.NodeAction, owner string, node *v1.Node) error {
+	return r.patchNode(ctx, node, func(node *v1.Node) {
+		removeNodeOwner(node, quarantineAnnotation, owner)
+		if taint := action.Taint; taint != nil {
+			removeTaint(node, taint)
+		}
+		for k, v := range action.Labels {
+			if node.Labels[k] == v {
+				delete(node.Labels, k)
+			}
+		}
+	})
+}
+
+// nodeOwners returns the owners recorded in the given annotation of the node.
+func nodeOwners(node *v1.Node, key string) []string {
+	if node.Annotations[key] == "" {
+		return nil
+	}
+	return strings.Split(node.Annotations[key], ",")
+}
+
+// hasNodeOwner reports whether the given annotation of the node records the owner.
+func hasNodeOwner(node *v1.Node, key, owner string) bool {
+	for _, o := range nodeOwners(node, key) {
+		if o == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// addNodeOwner records the owner in the given annotation of the node.
+func addNodeOwner(node *v1.Node, key, owner string) {
+	if hasNodeOwner(node, key, owner) {
+		return
+	}
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string, 1)
+	}
+	node.Annotations[key] = strings.Join(append(nodeOwners(node, key), owner), ",")
+}
+
+// removeNodeOwner removes the owner from the given annotation of the node, and
+// the annotation once it records no owner.
+func removeNodeOwner(node *v1.Node, key, owner string) {
+	var owners []string
+	for _, o := range nodeOwners(node, key) {
+		if o != owner {
+			owners = append(owners, o)
+		}
+	}
+	if len(owners) == 0 {
+		delete(node.Annotations, key)
+		return
+	}
+	node.Annotations[key] = strings.Join(owners, ",")
+}
+
+// patchNode patches the node with the changes of mutate, if any. The patch
+// fails if the node changed since it was read, the taints being replaced
+// as a whole.
+func (r *DaemonJobReconciler) patchNode(ctx context.Context, node *v1.Node, mutate func(*v1.Node)) error {
+	patched := node.DeepCopy()
+	mutate(patched)
+	if equalNodeMarks(node, patched) {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(node, client.MergeFromWithOptimisticLock{})
+	if err := r.Patch(ctx, patched, patch); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	*node = *patched
+	return nil
+}
+
+// equalNodeMarks reports whether the taints, labels, annotations and
+// schedulability of the nodes are the same.
+func equalNodeMarks(a, b *v1.Node) bool {
+	if a.Spec.Unschedulable != b.Spec.Unschedulable || len(a.Spec.Taints) != len(b.Spec.Taints) || len(a.Labels) != len(b.Labels) || len(a.Annotations) != len(b.Annotations) {
+		return false
+	}
+	for i := range a.Spec.Taints {
+		if !a.Spec.Taints[i].MatchTaint(&b.Spec.Taints[i]) || a.Spec.Taints[i].Value != b.Spec.Taints[i].Value {
+			return false
+		}
+	}
+	for k, v := range a.Labels {
+		if w, ok := b.Labels[k]; !ok || w != v {
+			return false
+		}
+	}
+	for k, v := range a.Annotations {
+		if w, ok := b.Annotations[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTaint reports whether the node has a taint with the key and effect of
+// the given taint.
+func hasTaint(node *v1.Node, taint *v1.Taint) bool {
+	for i := range node.Spec.Taints {
+		if node.Spec.Taints[i].MatchTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTaint removes the taints with the key and effect of the given taint
+// from the node.
+func removeTaint(node *v1.Node, taint *v1.Taint) {
+	var taints []v1.Taint
+	for _, t := range node.Spec.Taints {
+		if !t.MatchTaint(taint) {
+			taints = append(taints, t)
+		}
+	}
+	node.Spec.Taints = taints
+}
+
+// tolerateTaint lets the pods run on the nodes with the given taint, whatever
+// its value.
+func tolerateTaint(podSpec *v1.PodSpec, taint *v1.Taint) {
+	for i := range podSpec.Tolerations {
+		if podSpec.Tolerations[i].ToleratesTaint(taint) {
+			return
+		}
+	}
+	podSpec.Tolerations = append(podSpec.Tolerations, v1.Toleration{
+		Key:      taint.Key,
+		Operator: v1.TolerationOpExists,
+		Effect:   taint.Effect,
+	})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Quarantine", func() {
+
+	It("should cap the quarantined nodes", func() {
+		action := &daemonv1beta1.NodeAction{}
+		Expect(maxQuarantinedNodes(action, 50)).To(Equal(daemonv1beta1.DefaultMaxQuarantinedNodes))
+
+		percent := intstr.FromString("10%")
+		action.MaxQuarantinedNodes = &percent
+		Expect(maxQuarantinedNodes(action, 50)).To(Equal(5))
+		Expect(maxQuarantinedNodes(action, 3)).To(Equal(1))
+	})
+
+	It("should add and remove the taint once", func() {
+		taint := &v1.Taint{Key: "hardening.example.com/failed", Effect: v1.TaintEffectNoSchedule}
+		node := &v1.Node{Spec: v1.NodeSpec{Taints: []v1.Taint{
+			{Key: "hardening.example.com/failed", Effect: v1.TaintEffectNoExecute},
+		}}}
+		Expect(hasTaint(node, taint)).To(BeFalse())
+
+		node.Spec.Taints = append(node.Spec.Taints, *taint)
+		Expect(hasTaint(node, taint)).To(BeTrue())
+
+		removeTaint(node, taint)
+		Expect(node.Spec.Taints).To(HaveLen(1))
+		Expect(node.Spec.Taints[0].Effect).To(Equal(v1.TaintEffectNoExecute))
+	})
+
+	It("should record the owners on the node", func() {
+		node := &v1.Node{}
+		addNodeOwner(node, quarantineAnnotation, "default/a")
+		addNodeOwner(node, quarantineAnnotation, "default/b")
+		addNodeOwner(node, quarantineAnnotation, "default/a")
+		Expect(node.Annotations[quarantineAnnotation]).To(Equal("default/a,default/b"))
+		Expect(hasNodeOwner(node, quarantineAnnotation, "default/b")).To(BeTrue())
+		Expect(hasNodeOwner(node, quarantineAnnotation, "default/c")).To(BeFalse())
+
+		removeNodeOwner(node, quarantineAnnotation, "default/a")
+		Expect(node.Annotations[quarantineAnnotation]).To(Equal("default/b"))
+		removeNodeOwner(node, quarantineAnnotation, "default/b")
+		Expect(node.Annotations).NotTo(HaveKey(quarantineAnnotation))
+	})
+
+	It("should tolerate the quarantine taint whatever its value", func() {
+		taint := &v1.Taint{Key: "hardening.example.com/failed", Value: "true", Effect: v1.TaintEffectNoExecute}
+		spec := &v1.PodSpec{}
+		tolerateTaint(spec, taint)
+		Expect(spec.Tolerations).To(HaveLen(1))
+		Expect(spec.Tolerations[0].ToleratesTaint(taint)).To(BeTrue())
+		Expect(spec.Tolerations[0].ToleratesTaint(&v1.Taint{Key: taint.Key, Value: "other", Effect: taint.Effect})).To(BeTrue())
+
+		tolerateTaint(spec, taint)
+		Expect(spec.Tolerations).To(HaveLen(1))
+	})
+})
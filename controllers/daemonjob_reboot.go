@@ -0,0 +1,350 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// bootIDAnnotation records on the reboot job the boot ID of the node
+	// before its reboot.
+	bootIDAnnotation = "daemon.justk8s.com/boot-id"
+
+	eventReasonRebootRequired = "RebootRequired"
+	eventReasonReboot         = "Reboot"
+	eventReasonRebooted       = "Rebooted"
+	eventReasonRebootFailed   = "RebootFailed"
+)
+
+// rebootPending reports whether the node has to stay cordoned for its reboot.
+func rebootPending(nodeStatus *daemonv1beta1.NodeStatus) bool {
+	switch nodeStatus.Reboot {
+	case daemonv1beta1.RebootRequired, daemonv1beta1.RebootDraining, daemonv1beta1.Rebooting, daemonv1beta1.RebootFailed:
+		return true
+	}
+	return false
+}
+
+// maxRebootingNodes returns how many of the nodes of the DaemonJob may reboot
+// at once, a percentage being rounded up.
+func maxRebootingNodes(reboot *daemonv1beta1.RebootSpec, nodes int) int {
+	if reboot.MaxConcurrentNodes == nil {
+		return daemonv1beta1.DefaultMaxRebootingNodes
+	}
+	maxNodes, err := intstr.GetScaledValueFromIntOrPercent(reboot.MaxConcurrentNodes, nodes, true)
+	if err != nil {
+		return daemonv1beta1.DefaultMaxRebootingNodes
+	}
+	return maxNodes
+}
+
+// rebootTimeout returns how long a node may take to come back once its reboot
+// job is created.
+func rebootTimeout(reboot *daemonv1beta1.RebootSpec) time.Duration {
+	if reboot.TimeoutSeconds == nil {
+		return time.Duration(daemonv1beta1.DefaultRebootTimeoutSeconds) * time.Second
+	}
+	return time.Duration(*reboot.TimeoutSeconds) * time.Second
+}
+
+// nodeReady reports whether the node has the Ready condition.
+func nodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// reconcileReboots moves the nodes whose job requested a reboot through their
+// reboot, up to the cap of spec.reboot: the node is cordoned and drained, the
+// reboot job is created, and the node is rebooted once it is Ready with a new
+// boot ID. The nodes locked by the exclusion group wait before their drain and
+// their reboot job. The rebooted nodes are uncordoned by reconcileMaintenance.
+// The progress is recorded in the status, the rerun nodes starting over. It
+// returns the delay until the rebooting nodes are checked again, 0 if there
+// is none.
+func (r *DaemonJobReconciler) reconcileReboots(ctx context.Context, dj *daemonv1beta1.DaemonJob, status *daemonv1beta1.DaemonJobStatus, nodeList *v1.NodeList, jobs map[string]nodeJobs, locked map[string]string) (time.Duration, error) {
+	log := clog.FromContext(ctx)
+
+	reboot := dj.Spec.Reboot
+	if reboot == nil {
+		for i := range status.Nodes {
+			status.Nodes[i].Reboot = ""
+		}
+		return 0, nil
+	}
+	owner := nodeOwner(dj)
+
+	nodes := make(map[string]*v1.Node, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[nodeList.Items[i].Name] = &nodeList.Items[i]
+	}
+
+	requested, err := r.rebootRequests(ctx, dj, reboot, jobs)
+	if err != nil {
+		return 0, err
+	}
+
+	var rebooting int
+	for i := range status.Nodes {
+		switch status.Nodes[i].Reboot {
+		case daemonv1beta1.RebootDraining, daemonv1beta1.Rebooting, daemonv1beta1.RebootFailed:
+			rebooting++
+		}
+	}
+	maxNodes := maxRebootingNodes(reboot, int(status.DesiredNumberScheduled))
+
+	var next time.Duration
+	for i := range status.Nodes {
+		nodeStatus := &status.Nodes[i]
+		node := nodes[nodeStatus.NodeName]
+		rebootJob := jobs[nodeStatus.NodeName][rebootStage]
+		if rebootJob == nil && nodeStatus.Reboot == daemonv1beta1.Rebooting {
+			// the cache may not have seen the job created by the last reconcile
+			if rebootJob, err = r.getRebootJob(ctx, dj, nodeStatus.NodeName); err != nil {
+				return 0, err
+			}
+		}
+
+		// a rerun node requests its reboot again
+		if nodeStatus.Phase != daemonv1beta1.NodeSucceeded && nodeStatus.Reboot != daemonv1beta1.Rebooting {
+			nodeStatus.Reboot = ""
+		}
+		if nodeStatus.Reboot == "" && rebootJob != nil {
+			if err := r.deleteRebootJob(ctx, rebootJob); err != nil {
+				return 0, err
+			}
+		}
+		if node == nil {
+			continue
+		}
+
+		if nodeStatus.Phase == daemonv1beta1.NodeSucceeded && nodeStatus.Reboot == "" && requested[nodeStatus.NodeName] {
+			nodeStatus.Reboot = daemonv1beta1.RebootRequired
+			r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonRebootRequired, "Node %s requested a reboot", node.Name)
+		}
+
+		if nodeStatus.Reboot == daemonv1beta1.RebootRequired {
+			if !r.NodeActions {
+				nodeStatus.Reason = "waiting for reboot, node actions are disabled in the operator"
+				continue
+			}
+			current := node.Annotations[maintenanceAnnotation]
+			if current != "" && current != owner {
+				nodeStatus.Reason = fmt.Sprintf("waiting for reboot, in maintenance for %s", current)
+				continue
+			}
+			if rebooting >= maxNodes {
+				nodeStatus.Reason = fmt.Sprintf("waiting for reboot, %d node(s) rebooting", rebooting)
+				continue
+			}
+			if reason, ok := locked[node.Name]; ok {
+				nodeStatus.Reason = "waiting for reboot, " + reason
+				if next == 0 || exclusionRequeueDelay < next {
+					next = exclusionRequeueDelay
+				}
+				continue
+			}
+			// a node cordoned by someone else is left cordoned
+			if current == "" && !node.Spec.Unschedulable {
+				if err := r.cordon(ctx, owner, node); err != nil {
+					return 0, err
+				}
+				r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonCordon, "Cordoned node %s for its reboot", node.Name)
+			}
+			nodeStatus.Reboot = daemonv1beta1.RebootDraining
+			rebooting++
+		}
+
+		if nodeStatus.Reboot == daemonv1beta1.RebootDraining {
+			if reason, ok := locked[node.Name]; ok && rebootJob == nil {
+				nodeStatus.Reason = "waiting for reboot, " + reason
+				if next == 0 || exclusionRequeueDelay < next {
+					next = exclusionRequeueDelay
+				}
+				continue
+			}
+			if rebootJob == nil {
+				if reboot.Drain != nil {
+					reason, err := r.drainNode(ctx, dj, reboot.Drain, node.Name)
+					if err != nil {
+						return 0, err
+					}
+					if reason != "" {
+						nodeStatus.Reason = reason
+						if next == 0 || drainRequeueDelay < next {
+							next = drainRequeueDelay
+						}
+						continue
+					}
+				}
+				holds := make(map[string]string, 1)
+				if rebootJob, err = r.createRebootJob(ctx, dj, node, holds); err != nil {
+					return 0, err
+				}
+				if rebootJob == nil {
+					nodeStatus.Reason = holds[node.Name]
+					if next == 0 || admissionRequeueDelay < next {
+						next = admissionRequeueDelay
+					}
+					continue
+				}
+				log.Info("rebooting node", "node", node.Name)
+				r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonReboot, "Rebooting node %s", node.Name)
+			}
+			nodeStatus.Reboot = daemonv1beta1.Rebooting
+		}
+
+		if nodeStatus.Reboot == daemonv1beta1.Rebooting {
+			switch {
+			case rebootJob == nil:
+				// the boot ID before the reboot is lost with the job
+				nodeStatus.Reboot = daemonv1beta1.RebootFailed
+				r.Recorder.Eventf(dj, v1.EventTypeWarning, eventReasonRebootFailed, "The reboot job of node %s was deleted", node.Name)
+			case node.Status.NodeInfo.BootID != rebootJob.Annotations[bootIDAnnotation] && nodeReady(node):
+				if err := r.deleteRebootJob(ctx, rebootJob); err != nil {
+					return 0, err
+				}
+				nodeStatus.Reboot = daemonv1beta1.Rebooted
+				r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonRebooted, "Node %s rebooted", node.Name)
+			default:
+				left := rebootTimeout(reboot) - time.Since(rebootJob.CreationTimestamp.Time)
+				if left > 0 {
+					nodeStatus.Reason = "waiting for the node to reboot"
+					if next == 0 || left < next {
+						next = left
+					}
+					continue
+				}
+				// the reboot job must not reboot the node later on
+				if err := r.deleteRebootJob(ctx, rebootJob); err != nil {
+					return 0, err
+				}
+				nodeStatus.Reboot = daemonv1beta1.RebootFailed
+				r.Recorder.Eventf(dj, v1.EventTypeWarning, eventReasonRebootFailed, "Node %s did not reboot within %s", node.Name, rebootTimeout(reboot))
+			}
+		}
+	}
+
+	return next, nil
+}
+
+// rebootRequests returns the nodes where a pod of the DaemonJob terminated
+// with the reboot message. The reboot jobs and the jobs run outside of the
+// main pipeline do not request reboots.
+func (r *DaemonJobReconciler) rebootRequests(ctx context.Context, dj *daemonv1beta1.DaemonJob, reboot *daemonv1beta1.RebootSpec, jobs map[string]nodeJobs) (map[string]bool, error) {
+	nodeOfJob := make(map[types.UID]string)
+	for nodeName, nodeJobs := range jobs {
+		for stage, job := range nodeJobs {
+			switch stage {
+			case checkStage, teardownStage, onFailureStage, rebootStage:
+				continue
+			}
+			nodeOfJob[job.UID] = nodeName
+		}
+	}
+
+	var pods v1.PodList
+	if err := r.List(ctx, &pods,
+		client.InNamespace(dj.Namespace),
+		client.MatchingLabels{daemonJobUIDLabel: string(dj.UID)}); err != nil {
+		return nil, err
+	}
+
+	message := reboot.Message
+	if message == "" {
+		message = daemonv1beta1.DefaultRebootMessage
+	}
+	requested := make(map[string]bool)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		nodeName, ok := nodeOfJob[types.UID(pod.Labels["controller-uid"])]
+		if !ok || pod.Status.Phase != v1.PodSucceeded {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if terminated := status.State.Terminated; terminated != nil && strings.TrimSpace(terminated.Message) == message {
+				requested[nodeName] = true
+			}
+		}
+	}
+
+	return requested, nil
+}
+
+// createRebootJob creates the reboot job of the node, recording the boot ID
+// of the node before its reboot. It returns nil if the operator-wide limit of
+// active Jobs holds it back, the reason being recorded in holds.
+func (r *DaemonJobReconciler) createRebootJob(ctx context.Context, dj *daemonv1beta1.DaemonJob, node *v1.Node, holds map[string]string) (*batchv1.Job, error) {
+	job := newJob(dj.Namespace, dj, node.Name, rebootStage)
+	job.Annotations[bootIDAnnotation] = node.Status.NodeInfo.BootID
+	// the pod is killed by the reboot, it must not be run again on the node
+	backoffLimit := int32(0)
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+	tolerateUnschedulable(&job.Spec.Template.Spec)
+
+	admittedJobs, err := r.admitJobs(ctx, client.ObjectKeyFromObject(dj), dj.Spec.Priority, []*batchv1.Job{job}, holds)
+	if err != nil || len(admittedJobs) == 0 {
+		return nil, err
+	}
+	if err := ctrl.SetControllerReference(dj, job, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	if err := r.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// getRebootJob reads the reboot job of the node from the API server, nil if
+// there is none.
+func (r *DaemonJobReconciler) getRebootJob(ctx context.Context, dj *daemonv1beta1.DaemonJob, nodeName string) (*batchv1.Job, error) {
+	job := &batchv1.Job{}
+	key := client.ObjectKey{Namespace: dj.Namespace, Name: jobName(dj.Name, nodeName, rebootStage)}
+	if err := r.APIReader.Get(ctx, key, job); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// deleteRebootJob deletes the reboot job of a node, along with its pods.
+func (r *DaemonJobReconciler) deleteRebootJob(ctx context.Context, job *batchv1.Job) error {
+	err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	return client.IgnoreNotFound(err)
+}
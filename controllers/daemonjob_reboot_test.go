@@ -0,0 +1,69 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Reboot", func() {
+
+	It("should cap the rebooting nodes", func() {
+		reboot := &daemonv1beta1.RebootSpec{}
+		Expect(maxRebootingNodes(reboot, 50)).To(Equal(daemonv1beta1.DefaultMaxRebootingNodes))
+		Expect(rebootTimeout(reboot)).To(Equal(15 * time.Minute))
+
+		percent := intstr.FromString("10%")
+		reboot.MaxConcurrentNodes = &percent
+		Expect(maxRebootingNodes(reboot, 25)).To(Equal(3))
+	})
+
+	It("should keep the nodes cordoned until they rebooted", func() {
+		for phase, pending := range map[daemonv1beta1.RebootPhase]bool{
+			"":                           false,
+			daemonv1beta1.RebootRequired: true,
+			daemonv1beta1.RebootDraining: true,
+			daemonv1beta1.Rebooting:      true,
+			daemonv1beta1.Rebooted:       false,
+			daemonv1beta1.RebootFailed:   true,
+		} {
+			Expect(rebootPending(&daemonv1beta1.NodeStatus{Reboot: phase})).To(Equal(pending), string(phase))
+		}
+	})
+
+	It("should find the Ready nodes", func() {
+		node := &v1.Node{}
+		Expect(nodeReady(node)).To(BeFalse())
+
+		node.Status.Conditions = []v1.NodeCondition{
+			{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue},
+			{Type: v1.NodeReady, Status: v1.ConditionFalse},
+		}
+		Expect(nodeReady(node)).To(BeFalse())
+
+		node.Status.Conditions[1].Status = v1.ConditionTrue
+		Expect(nodeReady(node)).To(BeTrue())
+	})
+})
@@ -0,0 +1,185 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reconcileNodeReports writes a NodeReport for every completed child Job and
+// removes the reports of nodes that are gone. It returns the current reports,
+// sorted by node name.
+func (r *DaemonJobReconciler) reconcileNodeReports(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList, nodeList *v1.NodeList) ([]daemonv1alpha1.NodeReport, error) {
+	log := clog.FromContext(ctx)
+
+	nodes := make(map[string]*v1.Node, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[nodeList.Items[i].Name] = &nodeList.Items[i]
+	}
+
+	var reports daemonv1alpha1.NodeReportList
+	if err := r.List(ctx, &reports,
+		client.InNamespace(dj.Namespace),
+		client.MatchingLabels{daemonJobLabel: labelValue(dj.Name)}); err != nil {
+		return nil, err
+	}
+	reported := make(map[string]*daemonv1alpha1.NodeReport, len(reports.Items))
+	for i := range reports.Items {
+		// the label value of a long name may be shared with another DaemonJob
+		if !metav1.IsControlledBy(&reports.Items[i], dj) {
+			continue
+		}
+		reported[reports.Items[i].Spec.NodeName] = &reports.Items[i]
+	}
+
+	for i := range childJobs.Items {
+		job := &childJobs.Items[i]
+		if jobStatus(*job) != batchv1.JobComplete || job.Annotations[stageAnnotation] != reportStage(dj) {
+			continue
+		}
+
+		node, ok := nodes[job.Annotations[annotation]]
+		if !ok {
+			continue
+		}
+
+		// The output of this Job has already been collected, its pod may be gone by now
+		if report, ok := reported[node.Name]; ok && report.Spec.JobName == job.Name &&
+			report.Spec.CompletionTime.Equal(job.Status.CompletionTime) {
+			continue
+		}
+
+		output, err := r.jobOutput(ctx, dj, job)
+		if err != nil {
+			return nil, err
+		}
+
+		report := &daemonv1alpha1.NodeReport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      reportName(dj.Name, node.Name),
+				Namespace: dj.Namespace,
+			},
+		}
+		result, err := controllerutil.CreateOrUpdate(ctx, r.Client, report, func() error {
+			if report.Labels == nil {
+				report.Labels = make(map[string]string)
+			}
+			report.Labels[daemonJobLabel] = labelValue(dj.Name)
+			report.Labels[nodeNameLabel] = labelValue(node.Name)
+
+			report.Spec.DaemonJobName = dj.Name
+			report.Spec.NodeName = node.Name
+			report.Spec.NodeUID = node.UID
+			report.Spec.JobName = job.Name
+			report.Spec.TemplateHash = job.Annotations[templateHashAnnotation]
+			report.Spec.StartTime = job.Status.StartTime
+			report.Spec.CompletionTime = job.Status.CompletionTime
+			report.Spec.Output = nil
+			report.Spec.OutputError = ""
+			switch {
+			case output == "":
+				report.Spec.OutputError = "the job has no termination message"
+			case json.Valid([]byte(output)):
+				report.Spec.Output = &apiextensionsv1.JSON{Raw: []byte(output)}
+			default:
+				report.Spec.OutputError = "the termination message is not valid JSON"
+			}
+
+			return ctrl.SetControllerReference(dj, report, r.Scheme)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result != controllerutil.OperationResultNone {
+			log.Info("NodeReport written", "nodeReport", report.Name, "operation", result)
+		}
+		reported[node.Name] = report
+	}
+
+	// Remove the reports of nodes that no longer exist
+	for nodeName, report := range reported {
+		if _, ok := nodes[nodeName]; ok {
+			continue
+		}
+		if err := r.Delete(ctx, report); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		delete(reported, nodeName)
+		log.Info("NodeReport of removed node deleted", "nodeReport", report.Name)
+	}
+
+	current := make([]daemonv1alpha1.NodeReport, 0, len(reported))
+	for _, report := range reported {
+		current = append(current, *report)
+	}
+	sort.Slice(current, func(i, j int) bool {
+		return current[i].Spec.NodeName < current[j].Spec.NodeName
+	})
+
+	return current, nil
+}
+
+// collectsOutput returns true if the output of the jobs of the DaemonJob is
+// collected into NodeReports.
+func collectsOutput(dj *daemonv1beta1.DaemonJob) bool {
+	return dj.Spec.Report != nil || dj.Spec.ExpectConsistentOutput != nil
+}
+
+// jobOutput returns the termination message of the report container of the
+// succeeded pod of the given Job.
+func (r *DaemonJobReconciler) jobOutput(ctx context.Context, dj *daemonv1beta1.DaemonJob, job *batchv1.Job) (string, error) {
+	var containerName string
+	if dj.Spec.Report != nil {
+		containerName = dj.Spec.Report.ContainerName
+	}
+	if containerName == "" && len(job.Spec.Template.Spec.Containers) > 0 {
+		containerName = job.Spec.Template.Spec.Containers[0].Name
+	}
+
+	var pods v1.PodList
+	if err := r.List(ctx, &pods,
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{"controller-uid": string(job.UID)}); err != nil {
+		return "", err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodSucceeded {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == containerName && status.State.Terminated != nil {
+				return status.State.Terminated.Message, nil
+			}
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// rerunAnnotation requests a rerun of the DaemonJob whenever its value,
+	// the token of the run, changes.
+	rerunAnnotation = "daemon.justk8s.com/rerun"
+	// rerunScopeAnnotation selects the nodes of the rerun: all (default),
+	// failed, or a comma-separated list of node names.
+	rerunScopeAnnotation = "daemon.justk8s.com/rerun-scope"
+
+	rerunScopeAll    = "all"
+	rerunScopeFailed = "failed"
+
+	eventReasonRerun = "Rerun"
+)
+
+// pendingRerun returns the token of the rerun requested by the annotation,
+// and whether it has not run yet.
+func pendingRerun(dj *daemonv1beta1.DaemonJob) (string, bool) {
+	token := dj.Annotations[rerunAnnotation]
+	return token, token != "" && token != dj.Status.RerunToken
+}
+
+// rerunNodeNames returns the nodes with Jobs selected by the rerun scope.
+func rerunNodeNames(dj *daemonv1beta1.DaemonJob, jobs map[string]nodeJobs) []string {
+	var nodeNames []string
+
+	switch scope := dj.Annotations[rerunScopeAnnotation]; scope {
+	case "", rerunScopeAll:
+		for nodeName := range jobs {
+			nodeNames = append(nodeNames, nodeName)
+		}
+	case rerunScopeFailed:
+		for nodeName, nodeJobs := range jobs {
+			if status, _ := nodeProgress(dj, nodeName, nodeJobs); status.Phase == daemonv1beta1.NodeFailed {
+				nodeNames = append(nodeNames, nodeName)
+			}
+		}
+	default:
+		for _, nodeName := range strings.Split(scope, ",") {
+			nodeName = strings.TrimSpace(nodeName)
+			if _, ok := jobs[nodeName]; ok {
+				nodeNames = append(nodeNames, nodeName)
+			}
+		}
+	}
+
+	sort.Strings(nodeNames)
+	return nodeNames
+}
+
+// rerunJobs deletes the Jobs of the nodes selected by a pending rerun, so that
+// they are created again, and removes them from the child Jobs. It returns
+// the token of the last rerun.
+func (r *DaemonJobReconciler) rerunJobs(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList) (string, error) {
+	log := clog.FromContext(ctx)
+
+	token, pending := pendingRerun(dj)
+	if !pending {
+		return dj.Status.RerunToken, nil
+	}
+
+	nodeNames := rerunNodeNames(dj, jobsByNode(childJobs))
+	rerun := make(map[string]bool, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		rerun[nodeName] = true
+	}
+
+	kept := childJobs.Items[:0]
+	for i := range childJobs.Items {
+		job := &childJobs.Items[i]
+		// a reboot in progress runs to its end
+		stage := job.Annotations[stageAnnotation]
+		if !rerun[job.Annotations[annotation]] || stage == teardownStage || stage == rebootStage {
+			kept = append(kept, *job)
+			continue
+		}
+
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+	}
+	childJobs.Items = kept
+
+	// the nodes start over their retries
+	for i := range dj.Status.Nodes {
+		if rerun[dj.Status.Nodes[i].NodeName] {
+			dj.Status.Nodes[i].Retries = 0
+		}
+	}
+
+	log.Info("rerunning DaemonJob", "token", token, "nodes", nodeNames)
+	r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonRerun, "Rerun %s: replacing the Jobs of %d node(s)", token, len(nodeNames))
+
+	return token, nil
+}
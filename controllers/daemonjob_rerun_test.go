@@ -0,0 +1,66 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Rerun", func() {
+
+	job := func(condition batchv1.JobConditionType) *batchv1.Job {
+		return &batchv1.Job{Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: condition, Status: v1.ConditionTrue}},
+		}}
+	}
+	jobs := map[string]nodeJobs{
+		"node-a": {mainStage: job(batchv1.JobComplete)},
+		"node-b": {mainStage: job(batchv1.JobFailed)},
+		"node-c": {mainStage: job(batchv1.JobFailed)},
+	}
+	rerun := func(token, scope string) *daemonv1beta1.DaemonJob {
+		return &daemonv1beta1.DaemonJob{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				rerunAnnotation:      token,
+				rerunScopeAnnotation: scope,
+			}},
+		}
+	}
+
+	It("should only run a new token", func() {
+		dj := rerun("1", "")
+		_, pending := pendingRerun(dj)
+		Expect(pending).To(BeTrue())
+
+		dj.Status.RerunToken = "1"
+		_, pending = pendingRerun(dj)
+		Expect(pending).To(BeFalse())
+	})
+
+	It("should select the nodes of the scope", func() {
+		Expect(rerunNodeNames(rerun("1", ""), jobs)).To(Equal([]string{"node-a", "node-b", "node-c"}))
+		Expect(rerunNodeNames(rerun("1", rerunScopeFailed), jobs)).To(Equal([]string{"node-b", "node-c"}))
+		Expect(rerunNodeNames(rerun("1", "node-c, node-a,node-x"), jobs)).To(Equal([]string{"node-a", "node-c"}))
+	})
+})
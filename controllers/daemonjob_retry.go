@@ -0,0 +1,194 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// maxNodeRetryDelay caps the delay before the retry of a failed node
+	maxNodeRetryDelay = time.Hour
+
+	eventReasonNodeRetry = "NodeRetry"
+)
+
+// nodeRetryDelay returns the delay before the given retry of a failed node:
+// the initial delay, multiplied by the multiplier after each retry.
+func nodeRetryDelay(policy *daemonv1beta1.NodeRetryPolicy, retries int32) time.Duration {
+	initialDelaySeconds := daemonv1beta1.DefaultNodeRetryInitialDelaySeconds
+	if policy.InitialDelaySeconds != nil {
+		initialDelaySeconds = *policy.InitialDelaySeconds
+	}
+	delay := time.Duration(initialDelaySeconds) * time.Second
+	for i := int32(0); i < retries && delay < maxNodeRetryDelay; i++ {
+		delay *= time.Duration(policy.Multiplier)
+	}
+	if delay > maxNodeRetryDelay {
+		return maxNodeRetryDelay
+	}
+	return delay
+}
+
+// nodeRetries returns how many times the failed Jobs of the node were retried.
+func nodeRetries(dj *daemonv1beta1.DaemonJob, nodeName string) int32 {
+	for _, nodeStatus := range dj.Status.Nodes {
+		if nodeStatus.NodeName == nodeName {
+			return nodeStatus.Retries
+		}
+	}
+	return 0
+}
+
+// failedJob returns the failed Job of the node, if any, along with the time
+// it failed.
+func failedJob(jobs nodeJobs) (*batchv1.Job, time.Time) {
+	for stage, job := range jobs {
+		// a failed check only means the node has to be remediated
+		if stage == checkStage || stage == teardownStage || stage == onFailureStage || stage == rebootStage {
+			continue
+		}
+		for _, c := range job.Status.Conditions {
+			if c.Type == batchv1.JobFailed && c.Status == v1.ConditionTrue {
+				return job, c.LastTransitionTime.Time
+			}
+		}
+	}
+	return nil, time.Time{}
+}
+
+// retriedJobs returns the Jobs deleted to retry the failed Job of a node: the
+// failed Job, and the onFailure Job, which runs again if the node fails again.
+// A failed verify Job retries the fix, so the Jobs of the main stage or of
+// the steps are deleted too.
+func retriedJobs(job *batchv1.Job, jobs nodeJobs) []*batchv1.Job {
+	retried := []*batchv1.Job{job}
+	if j := jobs[onFailureStage]; j != nil {
+		retried = append(retried, j)
+	}
+	if job.Annotations[stageAnnotation] != verifyStage {
+		return retried
+	}
+	for stage, j := range jobs {
+		if fixesNode(stage) {
+			retried = append(retried, j)
+		}
+	}
+	return retried
+}
+
+// deleteFailedJob deletes the failed Job of a node so that it is created
+// again, along with the other Jobs of retriedJobs. The names of the deleted
+// Jobs are added to deleted.
+func (r *DaemonJobReconciler) deleteFailedJob(ctx context.Context, job *batchv1.Job, jobs nodeJobs, deleted map[string]bool) error {
+	for _, j := range retriedJobs(job, jobs) {
+		if err := r.Delete(ctx, j, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		deleted[j.Name] = true
+	}
+	return nil
+}
+
+// retryFailedNodes deletes the failed Jobs whose retry delay elapsed, so that
+// they are created again, and removes them from the child Jobs. The retries
+// are counted in the status of the nodes, updated before the Jobs are deleted
+// so that a failed reconcile does not lose them. The nodes still waiting for
+// their retry are held back with the reason. It returns the delay until the
+// next retry, 0 if there is none.
+func (r *DaemonJobReconciler) retryFailedNodes(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList, holds map[string]string) (time.Duration, error) {
+	log := clog.FromContext(ctx)
+
+	policy := dj.Spec.NodeRetryPolicy
+	if policy == nil {
+		return 0, nil
+	}
+
+	jobs := jobsByNode(childJobs)
+	var retries []*batchv1.Job
+	var next time.Duration
+	for i := range dj.Status.Nodes {
+		nodeStatus := &dj.Status.Nodes[i]
+		if nodeStatus.Retries >= policy.MaxRetries {
+			continue
+		}
+		status, _ := nodeProgress(dj, nodeStatus.NodeName, jobs[nodeStatus.NodeName])
+		if status.Phase != daemonv1beta1.NodeFailed {
+			continue
+		}
+		job, failedAt := failedJob(jobs[nodeStatus.NodeName])
+		if job == nil {
+			continue
+		}
+		// the onFailure job finishes before the node runs again
+		if status.OnFailure == daemonv1beta1.NodePending || status.OnFailure == daemonv1beta1.NodeRunning {
+			continue
+		}
+
+		delay := nodeRetryDelay(policy, nodeStatus.Retries)
+		if wait := time.Until(failedAt.Add(delay)); wait > 0 {
+			holds[nodeStatus.NodeName] = fmt.Sprintf("retry %d/%d in %s", nodeStatus.Retries+1, policy.MaxRetries, wait.Round(time.Second))
+			if next == 0 || wait < next {
+				next = wait
+			}
+			continue
+		}
+
+		nodeStatus.Retries++
+		retries = append(retries, job)
+	}
+	if len(retries) == 0 {
+		return next, nil
+	}
+
+	// the retries are counted before the Jobs are deleted, not to be lost
+	if err := r.Status().Update(ctx, dj); err != nil {
+		return 0, err
+	}
+
+	retried := make(map[string]bool)
+	for _, job := range retries {
+		nodeName := job.Annotations[annotation]
+		if err := r.deleteFailedJob(ctx, job, jobs[nodeName], retried); err != nil {
+			return 0, err
+		}
+
+		retry := nodeRetries(dj, nodeName)
+		log.Info("retrying failed node", "node", nodeName, "retry", retry)
+		r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonNodeRetry, "Retry %d/%d of Job %s on node %s",
+			retry, policy.MaxRetries, job.Name, nodeName)
+	}
+
+	kept := childJobs.Items[:0]
+	for _, job := range childJobs.Items {
+		if !retried[job.Name] {
+			kept = append(kept, job)
+		}
+	}
+	childJobs.Items = kept
+
+	return next, nil
+}
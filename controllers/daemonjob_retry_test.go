@@ -0,0 +1,86 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+)
+
+var _ = Describe("Node retries", func() {
+
+	initialDelaySeconds := int32(10)
+	policy := &daemonv1beta1.NodeRetryPolicy{MaxRetries: 20, InitialDelaySeconds: &initialDelaySeconds, Multiplier: 2}
+
+	It("should back off exponentially", func() {
+		Expect(nodeRetryDelay(policy, 0)).To(Equal(10 * time.Second))
+		Expect(nodeRetryDelay(policy, 1)).To(Equal(20 * time.Second))
+		Expect(nodeRetryDelay(policy, 3)).To(Equal(80 * time.Second))
+	})
+
+	It("should cap the delay", func() {
+		Expect(nodeRetryDelay(policy, 19)).To(Equal(maxNodeRetryDelay))
+	})
+
+	It("should keep a constant delay with a multiplier of 1", func() {
+		initialDelaySeconds := int32(5)
+		constant := &daemonv1beta1.NodeRetryPolicy{MaxRetries: 3, InitialDelaySeconds: &initialDelaySeconds, Multiplier: 1}
+		Expect(nodeRetryDelay(constant, 2)).To(Equal(5 * time.Second))
+	})
+
+	It("should retry at once with no initial delay", func() {
+		initialDelaySeconds := int32(0)
+		immediate := &daemonv1beta1.NodeRetryPolicy{MaxRetries: 3, InitialDelaySeconds: &initialDelaySeconds, Multiplier: 2}
+		Expect(nodeRetryDelay(immediate, 2)).To(BeZero())
+
+		immediate.InitialDelaySeconds = nil
+		Expect(nodeRetryDelay(immediate, 0)).To(Equal(10 * time.Second))
+	})
+
+	It("should only retry the failed steps", func() {
+		failed := &batchv1.Job{Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue}},
+		}}
+		job, _ := failedJob(nodeJobs{checkStage: failed})
+		Expect(job).To(BeNil())
+
+		job, _ = failedJob(nodeJobs{mainStage: failed})
+		Expect(job).To(BeIdenticalTo(failed))
+	})
+
+	It("should run the fix again when the verify fails", func() {
+		newStageJob := func(stage string) *batchv1.Job {
+			return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{stageAnnotation: stage}}}
+		}
+		jobs := nodeJobs{}
+		for _, stage := range []string{checkStage, "apply", "restart", verifyStage, onFailureStage} {
+			jobs[stage] = newStageJob(stage)
+		}
+
+		Expect(retriedJobs(jobs["restart"], jobs)).To(ConsistOf(jobs["restart"], jobs[onFailureStage]))
+		Expect(retriedJobs(jobs[verifyStage], jobs)).To(ConsistOf(
+			jobs[verifyStage], jobs["apply"], jobs["restart"], jobs[onFailureStage]))
+	})
+})
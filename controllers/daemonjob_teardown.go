@@ -0,0 +1,202 @@
+/*
+Copyright 2021. @mcbenjemaa
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// daemonJobFinalizer holds a DaemonJob back until its nodes have been torn
+	// down and its Jobs released, as the deletion policy says.
+	daemonJobFinalizer = "daemon.justk8s.com/cleanup"
+
+	eventReasonTeardown       = "Teardown"
+	eventReasonTeardownFailed = "TeardownFailed"
+)
+
+// needsFinalizer returns whether the deletion of the DaemonJob has to wait
+// for the operator. Otherwise, the Jobs are deleted by the garbage collector.
+func needsFinalizer(dj *daemonv1beta1.DaemonJob) bool {
+	return dj.Spec.TeardownTemplate != nil || dj.Spec.DeletionPolicy == daemonv1beta1.DeletionPolicyOrphan ||
+		quarantineAction(dj) != nil || patchesSucceededNodes(dj) || maintainsNodes(dj) || dj.Spec.Reboot != nil
+}
+
+// reconcileFinalizer adds the finalizer to the DaemonJobs that need it, and
+// removes it from the others. It returns whether the DaemonJob was updated.
+func (r *DaemonJobReconciler) reconcileFinalizer(ctx context.Context, dj *daemonv1beta1.DaemonJob) (bool, error) {
+	switch {
+	case needsFinalizer(dj) && !controllerutil.ContainsFinalizer(dj, daemonJobFinalizer):
+		controllerutil.AddFinalizer(dj, daemonJobFinalizer)
+	case !needsFinalizer(dj) && controllerutil.ContainsFinalizer(dj, daemonJobFinalizer):
+		controllerutil.RemoveFinalizer(dj, daemonJobFinalizer)
+	default:
+		return false, nil
+	}
+
+	return true, r.Update(ctx, dj)
+}
+
+// finalizeDaemonJob runs the teardown Jobs, lifts the quarantine, removes
+// the marks and uncordons the nodes, then releases the child Jobs if the deletion policy
+// is Orphan, and lets the DaemonJob go.
+func (r *DaemonJobReconciler) finalizeDaemonJob(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList, nodeList *v1.NodeList) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(dj, daemonJobFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if dj.Spec.TeardownTemplate != nil {
+		done, held, err := r.teardownNodes(ctx, dj, childJobs, nodeList)
+		if err != nil || !done {
+			// the teardown Jobs trigger a reconcile when they finish, the
+			// held ones are tried again later
+			if held {
+				return ctrl.Result{RequeueAfter: admissionRequeueDelay}, err
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.liftAllQuarantines(ctx, dj, nodeList); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.unmarkAllNodes(ctx, dj, nodeList); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.uncordonAllNodes(ctx, dj, nodeList); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if dj.Spec.DeletionPolicy == daemonv1beta1.DeletionPolicyOrphan {
+		if err := r.orphanJobs(ctx, dj, childJobs); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(dj, daemonJobFinalizer)
+	return ctrl.Result{}, r.Update(ctx, dj)
+}
+
+// teardownNodes creates the teardown Job of every node where the DaemonJob
+// succeeded, as the exclusion group and the operator-wide limit of active
+// Jobs let them, and returns whether they all finished, and whether some are
+// held back. The nodes removed from the cluster are skipped.
+func (r *DaemonJobReconciler) teardownNodes(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList, nodeList *v1.NodeList) (bool, bool, error) {
+	log := clog.FromContext(ctx)
+
+	nodes := make(map[string]bool, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		nodes[node.Name] = true
+	}
+	jobs := jobsByNode(childJobs)
+
+	unlock := r.exclusion.lock(dj.Spec.ExclusionGroup)
+	defer unlock()
+	holds := make(map[string]string)
+	if _, err := r.exclusionHolds(ctx, dj, holds); err != nil {
+		return false, false, err
+	}
+
+	done, held := true, false
+	var desiredJobs []*batchv1.Job
+	var failed []string
+	for _, nodeStatus := range dj.Status.Nodes {
+		if nodeStatus.Phase != daemonv1beta1.NodeSucceeded || !nodes[nodeStatus.NodeName] {
+			continue
+		}
+
+		phase, next := stageProgress(jobs[nodeStatus.NodeName], teardownStage)
+		switch phase {
+		case daemonv1beta1.NodeSucceeded:
+			continue
+		case daemonv1beta1.NodeFailed:
+			failed = append(failed, nodeStatus.NodeName)
+			continue
+		}
+		done = false
+		if next == nil {
+			continue
+		}
+		if _, locked := holds[nodeStatus.NodeName]; locked {
+			held = true
+			continue
+		}
+
+		desiredJobs = append(desiredJobs, newJob(dj.Namespace, dj, nodeStatus.NodeName, *next))
+	}
+
+	admittedJobs, err := r.admitJobs(ctx, client.ObjectKeyFromObject(dj), dj.Spec.Priority, desiredJobs, holds)
+	if err != nil {
+		return false, false, err
+	}
+	var created []string
+	for _, job := range admittedJobs {
+		if err := ctrl.SetControllerReference(dj, job, r.Scheme); err != nil {
+			return false, false, err
+		}
+		if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+			return false, false, err
+		}
+		created = append(created, job.Annotations[annotation])
+	}
+
+	if len(created) > 0 {
+		log.Info("tearing down nodes", "nodes", created)
+		r.Recorder.Eventf(dj, v1.EventTypeNormal, eventReasonTeardown, "Running the teardown Job on %d node(s)", len(created))
+	}
+	if done {
+		for _, nodeName := range failed {
+			r.Recorder.Eventf(dj, v1.EventTypeWarning, eventReasonTeardownFailed, "Teardown Job failed on node %s", nodeName)
+		}
+	}
+
+	return done, held || len(admittedJobs) < len(desiredJobs), nil
+}
+
+// orphanJobs removes the DaemonJob from the owners of its Jobs, so that the
+// garbage collector leaves them in place. They keep their labels, and are
+// adopted by a later DaemonJob of the same name.
+func (r *DaemonJobReconciler) orphanJobs(ctx context.Context, dj *daemonv1beta1.DaemonJob, childJobs *batchv1.JobList) error {
+	for i := range childJobs.Items {
+		job := &childJobs.Items[i]
+
+		patch := client.MergeFrom(job.DeepCopy())
+		var owners []metav1.OwnerReference
+		for _, owner := range job.OwnerReferences {
+			if owner.UID != dj.UID {
+				owners = append(owners, owner)
+			}
+		}
+		job.OwnerReferences = owners
+		delete(job.Labels, daemonJobUIDLabel)
+		if err := r.Patch(ctx, job, patch); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -32,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	daemonv1alpha1 "github.com/mcbenjemaa/daemonjob-operator/api/v1alpha1"
+	daemonv1beta1 "github.com/mcbenjemaa/daemonjob-operator/api/v1beta1"
 	"github.com/mcbenjemaa/daemonjob-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -45,6 +46,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(daemonv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(daemonv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,11 +54,18 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var maxActiveJobs int
+	var enableNodeActions bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&maxActiveJobs, "max-active-jobs", 0,
+		"The maximum number of active Jobs across all DaemonJobs. 0 means no limit.")
+	flag.BoolVar(&enableNodeActions, "enable-node-actions", false,
+		"Let the DaemonJobs taint, label and annotate the nodes. "+
+			"The operator must be bound to the node ClusterRole.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -78,13 +87,32 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.DaemonJobReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	daemonJobReconciler := &controllers.DaemonJobReconciler{
+		Client:        mgr.GetClient(),
+		APIReader:     mgr.GetAPIReader(),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("daemonjob-controller"),
+		MaxActiveJobs: maxActiveJobs,
+		NodeActions:   enableNodeActions,
+	}
+	if err = daemonJobReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DaemonJob")
 		os.Exit(1)
 	}
+	if err = (&controllers.ClusterDaemonJobReconciler{
+		Client:     mgr.GetClient(),
+		Scheme:     mgr.GetScheme(),
+		DaemonJobs: daemonJobReconciler,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterDaemonJob")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&daemonv1beta1.DaemonJob{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DaemonJob")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {